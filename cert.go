@@ -0,0 +1,188 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build !purego && cgo
+// +build !purego,cgo
+
+package zyre
+
+//#cgo pkg-config: libczmq
+//#include<zyre.h>
+//void _zcert_set_meta(zcert_t *self, const char *name, const char *value) {
+//  zcert_set_meta(self, name, "%s", value);
+//}
+//int _zauth_allow_curve(zactor_t *self, const char *location) {
+//  int rc = zstr_sendx(self, "CURVE", location, NULL);
+//  if (rc == -1)
+//      return -1;
+//  return zsock_wait(self);
+//}
+//zactor_t *_zauth_new() {
+//  return zactor_new(zauth, NULL);
+//}
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+var (
+	// ErrCertNew is returned when CURVE key pair can't be generated
+	ErrCertNew = errors.New("zcert_new returned NULL")
+
+	// ErrAuthNew is returned when zauth actor can't be started
+	ErrAuthNew = errors.New("zactor_new(zauth) returned NULL")
+)
+
+// Cert is a CURVE certificate, a key pair with optional metadata. Cert
+// loaded from public certificate file has zero SecretKey.
+type Cert struct {
+	PublicKey [32]byte
+	SecretKey [32]byte
+	Metadata  map[string]string
+}
+
+// HasCurve returns true if underlying libzmq supports CURVE security
+func HasCurve() bool {
+	return bool(C.zsys_has_curve())
+}
+
+// NewCert generates a new CURVE key pair
+func NewCert() (*Cert, error) {
+	zcert := C.zcert_new()
+	if zcert == nil {
+		return nil, ErrCertNew
+	}
+	defer C.zcert_destroy(&zcert)
+	return certFromZcert(zcert), nil
+}
+
+// LoadCert loads certificate saved by Cert.Save or czmq zcert_save. If
+// secret file (filename + "_secret") exists, it is loaded instead, so
+// certificate has both keys.
+func LoadCert(filename string) (*Cert, error) {
+	cfilename, free := cString(filename)
+	defer free()
+	zcert := C.zcert_load(cfilename)
+	if zcert == nil {
+		return nil, fmt.Errorf("LoadCert: can't load %s", filename)
+	}
+	defer C.zcert_destroy(&zcert)
+	return certFromZcert(zcert), nil
+}
+
+// Save saves public certificate to filename and secret certificate to
+// filename + "_secret". Files are in ZPL format used by czmq.
+func (c *Cert) Save(filename string) error {
+	zcert := c.zcert()
+	defer C.zcert_destroy(&zcert)
+	cfilename, free := cString(filename)
+	defer free()
+	rc := C.zcert_save(zcert, cfilename)
+	if rc == -1 {
+		return fmt.Errorf("Cert.Save: can't save %s", filename)
+	}
+	return nil
+}
+
+// SavePublic saves public certificate only to filename
+func (c *Cert) SavePublic(filename string) error {
+	zcert := c.zcert()
+	defer C.zcert_destroy(&zcert)
+	cfilename, free := cString(filename)
+	defer free()
+	rc := C.zcert_save_public(zcert, cfilename)
+	if rc == -1 {
+		return fmt.Errorf("Cert.SavePublic: can't save %s", filename)
+	}
+	return nil
+}
+
+// PublicText returns public key encoded in Z85
+func (c *Cert) PublicText() string {
+	zcert := c.zcert()
+	defer C.zcert_destroy(&zcert)
+	return C.GoString(C.zcert_public_txt(zcert))
+}
+
+// SecretText returns secret key encoded in Z85
+func (c *Cert) SecretText() string {
+	zcert := c.zcert()
+	defer C.zcert_destroy(&zcert)
+	return C.GoString(C.zcert_secret_txt(zcert))
+}
+
+// zcert creates `zcert_t*` from Go certificate, caller must destroy it
+func (c *Cert) zcert() *C.zcert_t {
+	zcert := C.zcert_new_from(
+		(*C.byte)(unsafe.Pointer(&c.PublicKey[0])),
+		(*C.byte)(unsafe.Pointer(&c.SecretKey[0])))
+	for name, value := range c.Metadata {
+		cname, freeName := cString(name)
+		cvalue, freeValue := cString(value)
+		C._zcert_set_meta(zcert, cname, cvalue)
+		freeName()
+		freeValue()
+	}
+	return zcert
+}
+
+func certFromZcert(zcert *C.zcert_t) *Cert {
+	c := &Cert{
+		Metadata: make(map[string]string),
+	}
+	copy(c.PublicKey[:], C.GoBytes(unsafe.Pointer(C.zcert_public_key(zcert)), 32))
+	copy(c.SecretKey[:], C.GoBytes(unsafe.Pointer(C.zcert_secret_key(zcert)), 32))
+	for _, name := range zlistTosliceAndDestroy(C.zcert_meta_keys(zcert)) {
+		cname, free := cString(name)
+		c.Metadata[name] = C.GoString(C.zcert_meta(zcert, cname))
+		free()
+	}
+	return c
+}
+
+// Auth is a ZAP authenticator (czmq zauth actor). Nodes using CURVE
+// certificates need one running in the process, otherwise connections
+// are not authenticated and peers never meet.
+type Auth struct {
+	ptr *C.zactor_t
+}
+
+// NewAuth starts a new authenticator
+func NewAuth() (*Auth, error) {
+	ptr := C._zauth_new()
+	if ptr == nil {
+		return nil, ErrAuthNew
+	}
+	return &Auth{ptr: ptr}, nil
+}
+
+// AllowCurve - allow CURVE clients with public certificates stored in
+// directory. Empty directory allows any client with valid key pair.
+func (a *Auth) AllowCurve(directory string) error {
+	if a.ptr == nil {
+		panic("Auth.AllowCurve: a.ptr is null")
+	}
+	if directory == "" {
+		directory = "*" // CURVE_ALLOW_ANY
+	}
+	cdirectory, free := cString(directory)
+	defer free()
+	rc := C._zauth_allow_curve(a.ptr, cdirectory)
+	if rc == -1 {
+		return fmt.Errorf("Auth.AllowCurve: returned -1")
+	}
+	return nil
+}
+
+// Destroy stops the authenticator
+func (a *Auth) Destroy() {
+	if a.ptr == nil {
+		return
+	}
+	C.zactor_destroy(&a.ptr)
+	a.ptr = nil
+}
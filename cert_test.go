@@ -0,0 +1,52 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build !purego && cgo
+// +build !purego,cgo
+
+package zyre
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCert(t *testing.T) {
+
+	assert := assert.New(t)
+
+	if !HasCurve() {
+		t.Skip("libzmq has no CURVE support")
+	}
+
+	cert, err := NewCert()
+	assert.NoError(err)
+	cert.Metadata["name"] = "node"
+	assert.Len(cert.PublicText(), 40)
+
+	dir, err := os.MkdirTemp("", "gozyre")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "node.cert")
+	err = cert.Save(path)
+	assert.NoError(err)
+	loaded, err := LoadCert(path)
+	assert.NoError(err)
+	assert.Equal(cert, loaded)
+
+	path = filepath.Join(dir, "public.cert")
+	err = cert.SavePublic(path)
+	assert.NoError(err)
+	loaded, err = LoadCert(path)
+	assert.NoError(err)
+	assert.Equal(cert.PublicKey, loaded.PublicKey)
+	assert.Equal([32]byte{}, loaded.SecretKey)
+
+	_, err = LoadCert(filepath.Join(dir, "missing.cert"))
+	assert.Error(err)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package codec sends Go values by Whisper and Shout and decodes received
+// messages into registered Go types.
+//
+// Typed message has frames "ZTYPE/1", content type of the codec, name of
+// the type and encoded value. Types are registered under names known to
+// both peers:
+//
+//	registry := codec.NewRegistry()
+//	registry.Register("chat.Message", ChatMessage{})
+//	typed := codec.New(node, registry, codec.JSON)
+//	typed.SendTyped(peer, ChatMessage{Text: "hello"})
+//
+//	m, err := registry.Decode(event)
+//	if err == nil {
+//		msg := m.Value.(ChatMessage)
+//	}
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes and decodes values
+type Codec interface {
+	// ContentType - MIME type of encoded values, used to select the codec
+	// on receipt
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes values by encoding/json
+	JSON Codec = jsonCodec{}
+
+	// MessagePack encodes values in MessagePack format
+	MessagePack Codec = msgpackCodec{}
+
+	// CBOR encodes values in CBOR format (RFC 8949)
+	CBOR Codec = cborCodec{}
+
+	// Protobuf encodes values implementing proto.Message
+	Protobuf Codec = protobufCodec{}
+)
+
+// ErrNotProto is returned by Protobuf codec for values not implementing
+// proto.Message
+var ErrNotProto = errors.New("codec: value is not proto.Message")
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string {
+	return "application/cbor"
+}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return "application/protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotProto, v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotProto, v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package codec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type chat struct {
+	From string
+	Text string
+	Tags []string
+}
+
+type position struct {
+	X, Y float64
+}
+
+// recorder keeps sent frames
+type recorder struct {
+	frames [][]byte
+	group  string
+}
+
+func (r *recorder) Whisper(peer string, data ...[]byte) error {
+	r.frames = data
+	return nil
+}
+
+func (r *recorder) Shout(group string, data ...[]byte) error {
+	r.frames, r.group = data, group
+	return nil
+}
+
+func newRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	for name, v := range map[string]interface{}{
+		"chat":      chat{},
+		"position":  &position{},
+		"timestamp": &timestamppb.Timestamp{},
+	} {
+		if err := r.Register(name, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestCodecs(t *testing.T) {
+
+	assert := assert.New(t)
+
+	r := newRegistry(t)
+	msg := chat{From: "alice", Text: "hello", Tags: []string{"a", "b"}}
+	ts := timestamppb.New(time.Unix(1560000000, 42))
+
+	for _, c := range []Codec{JSON, MessagePack, CBOR} {
+		rec := &recorder{}
+		typed := New(rec, r, c)
+
+		assert.NoError(typed.SendTyped("PEER", msg))
+		assert.Equal(c.ContentType(), string(rec.frames[1]))
+		assert.Equal("chat", string(rec.frames[2]))
+		m, err := r.Decode(zyre.Whisper{Peer: "PEER", Name: "peer", Message: rec.frames})
+		assert.NoError(err, c.ContentType())
+		assert.Equal(Message{Peer: "PEER", Name: "peer", Type: "chat", Value: msg}, m)
+
+		assert.NoError(typed.ShoutTyped("GROUP", &position{X: 1.5, Y: -2}))
+		m, err = r.Decode(zyre.Shout{Peer: "PEER", Group: rec.group, Message: rec.frames})
+		assert.NoError(err, c.ContentType())
+		assert.Equal("GROUP", m.Group)
+		assert.Equal(&position{X: 1.5, Y: -2}, m.Value)
+	}
+
+	rec := &recorder{}
+	typed := New(rec, r, Protobuf)
+	assert.NoError(typed.SendTyped("PEER", ts))
+	assert.Equal("application/protobuf", string(rec.frames[1]))
+	m, err := r.Decode(zyre.Whisper{Peer: "PEER", Message: rec.frames})
+	assert.NoError(err)
+	assert.True(proto.Equal(ts, m.Value.(*timestamppb.Timestamp)))
+	assert.True(errors.Is(typed.SendTyped("PEER", msg), ErrNotProto))
+}
+
+func TestRegistry(t *testing.T) {
+
+	assert := assert.New(t)
+
+	r := newRegistry(t)
+	assert.Error(r.Register("chat", position{}))
+	assert.Error(r.Register("other", chat{}))
+	assert.Error(r.Register("", chat{}))
+
+	typed := New(&recorder{}, r, JSON)
+	assert.True(errors.Is(typed.SendTyped("PEER", position{}), ErrUnknownType))
+
+	_, err := r.Decode(zyre.Whisper{Message: [][]byte{[]byte("hello")}})
+	assert.Equal(ErrNotTyped, err)
+	_, err = r.Decode(zyre.Join{Peer: "PEER"})
+	assert.Equal(ErrNotTyped, err)
+
+	frames := [][]byte{[]byte(protocol), []byte("application/json"), []byte("missing"), []byte("{}")}
+	m, err := r.Decode(zyre.Whisper{Message: frames})
+	assert.True(errors.Is(err, ErrUnknownType))
+	assert.Equal("missing", m.Type)
+	frames[1], frames[2] = []byte("text/xml"), []byte("chat")
+	_, err = r.Decode(zyre.Whisper{Message: frames})
+	assert.True(errors.Is(err, ErrUnknownCodec))
+	frames[1], frames[3] = []byte("application/json"), []byte("{")
+	_, err = r.Decode(zyre.Whisper{Message: frames})
+	assert.Error(err)
+}
+
+func TestTypedNodes(t *testing.T) {
+
+	assert := assert.New(t)
+
+	newNode := func(name string) (*zyre.Node, <-chan zyre.Event, context.CancelFunc) {
+		node, err := zyre.New(name, zyre.SetPort(5687))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		events, _ := node.Events(ctx)
+		if err := node.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return node, events, cancel
+	}
+	sender, senderEvents, cancel := newNode("sender")
+	defer sender.Destroy()
+	defer cancel()
+	receiver, events, cancel := newNode("receiver")
+	defer receiver.Destroy()
+	defer cancel()
+	go func() {
+		for range senderEvents {
+		}
+	}()
+
+	r := newRegistry(t)
+	timeout := time.After(5 * time.Second)
+	for uuid := ""; uuid != sender.UUID(); {
+		select {
+		case e := <-events:
+			uuid = e.PeerID()
+		case <-timeout:
+			t.Fatal("ENTER not received")
+		}
+	}
+
+	msg := chat{From: "sender", Text: "hi"}
+	assert.NoError(New(sender, r, MessagePack).SendTyped(receiver.UUID(), msg))
+	for {
+		select {
+		case e := <-events:
+			m, err := r.Decode(e)
+			if err == ErrNotTyped {
+				continue
+			}
+			assert.NoError(err)
+			assert.Equal(sender.UUID(), m.Peer)
+			assert.Equal(msg, m.Value)
+		case <-timeout:
+			t.Fatal("typed message not received")
+		}
+		break
+	}
+	sender.Stop()
+	receiver.Stop()
+}
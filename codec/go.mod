@@ -0,0 +1,19 @@
+module github.com/zeromq/gozyre/codec
+
+go 1.21
+
+require (
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/stretchr/testify v1.9.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	github.com/zeromq/gozyre v0.0.0-20261017060100-93a44191d43f
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,193 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZTYPE/1"
+
+var (
+	// ErrNotTyped is returned by Decode for events which are not typed
+	// messages
+	ErrNotTyped = errors.New("codec: not a typed message")
+
+	// ErrUnknownType is returned for types which are not registered
+	ErrUnknownType = errors.New("codec: unknown type")
+
+	// ErrUnknownCodec is returned for content types without codec
+	ErrUnknownCodec = errors.New("codec: unknown content type")
+)
+
+// Message is a decoded typed message
+type Message struct {
+	Peer  string
+	Name  string
+	Group string // empty for messages sent by Whisper
+	Type  string
+	Value interface{}
+}
+
+// Registry maps names to Go types and content types to codecs, it is safe
+// for concurrent use
+type Registry struct {
+	mu     sync.RWMutex
+	types  map[string]reflect.Type
+	names  map[reflect.Type]string
+	codecs map[string]Codec
+}
+
+// NewRegistry creates a registry with JSON, MessagePack, CBOR and Protobuf
+// codecs
+func NewRegistry() *Registry {
+	r := &Registry{
+		types:  make(map[string]reflect.Type),
+		names:  make(map[reflect.Type]string),
+		codecs: make(map[string]Codec),
+	}
+	for _, c := range []Codec{JSON, MessagePack, CBOR, Protobuf} {
+		r.RegisterCodec(c)
+	}
+	return r
+}
+
+// RegisterCodec makes codec available for decoding, it replaces codec of the
+// same content type
+func (r *Registry) RegisterCodec(c Codec) {
+	r.mu.Lock()
+	r.codecs[c.ContentType()] = c
+	r.mu.Unlock()
+}
+
+// Register registers type of prototype under name. Decoded values have the
+// same type as prototype, register pointers for protobuf messages.
+func (r *Registry) Register(name string, prototype interface{}) error {
+	if name == "" || prototype == nil {
+		return fmt.Errorf("Registry.Register: empty name or nil prototype")
+	}
+	t := reflect.TypeOf(prototype)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.types[name]; ok {
+		return fmt.Errorf("Registry.Register: %s is already registered", name)
+	}
+	if other, ok := r.names[t]; ok {
+		return fmt.Errorf("Registry.Register: %v is already registered as %s", t, other)
+	}
+	r.types[name] = t
+	r.names[t] = name
+	return nil
+}
+
+// Encode returns frames of typed message with v encoded by c, the type of
+// v must be registered
+func (r *Registry) Encode(c Codec, v interface{}) ([][]byte, error) {
+	r.mu.RLock()
+	name, ok := r.names[reflect.TypeOf(v)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnknownType, v)
+	}
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{[]byte(protocol), []byte(c.ContentType()), []byte(name), data}, nil
+}
+
+// Decode decodes Whisper or Shout event into a value of registered type,
+// it returns ErrNotTyped for other events
+func (r *Registry) Decode(e zyre.Event) (Message, error) {
+	var m Message
+	var frames [][]byte
+	switch e := e.(type) {
+	case zyre.Whisper:
+		m = Message{Peer: e.Peer, Name: e.Name}
+		frames = e.Message
+	case zyre.Shout:
+		m = Message{Peer: e.Peer, Name: e.Name, Group: e.Group}
+		frames = e.Message
+	default:
+		return m, ErrNotTyped
+	}
+	if len(frames) != 4 || string(frames[0]) != protocol {
+		return m, ErrNotTyped
+	}
+	m.Type = string(frames[2])
+	v, err := r.decode(string(frames[1]), m.Type, frames[3])
+	m.Value = v
+	return m, err
+}
+
+func (r *Registry) decode(contentType, name string, data []byte) (interface{}, error) {
+	r.mu.RLock()
+	c, ok := r.codecs[contentType]
+	t, known := r.types[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, contentType)
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := c.Unmarshal(data, v.Interface()); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+	v := reflect.New(t)
+	if err := c.Unmarshal(data, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// Sender sends whispers and shouts, it is implemented by *zyre.Node
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	Shout(group string, data ...[]byte) error
+}
+
+// Typed sends values of types registered in a registry by a codec
+type Typed struct {
+	sender   Sender
+	registry *Registry
+	codec    Codec
+}
+
+// New creates Typed sending by sender (usually *zyre.Node)
+func New(sender Sender, registry *Registry, codec Codec) *Typed {
+	return &Typed{
+		sender:   sender,
+		registry: registry,
+		codec:    codec,
+	}
+}
+
+// SendTyped sends v to peer by Whisper
+func (t *Typed) SendTyped(peer string, v interface{}) error {
+	frames, err := t.registry.Encode(t.codec, v)
+	if err != nil {
+		return err
+	}
+	return t.sender.Whisper(peer, frames...)
+}
+
+// ShoutTyped sends v to group by Shout
+func (t *Typed) ShoutTyped(group string, v interface{}) error {
+	frames, err := t.registry.Encode(t.codec, v)
+	if err != nil {
+		return err
+	}
+	return t.sender.Shout(group, frames...)
+}
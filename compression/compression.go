@@ -0,0 +1,326 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package compression compresses Whisper and Shout payloads for peers which
+// declared support in their headers.
+//
+// Node declares the algorithms it decompresses by Advertise option, which
+// sets header X-ZYRE-COMPRESSION, for example "zstd,gzip". Compressor sends
+// compressed frames only to peers with the header, Shout is compressed only
+// if all peers in the group support the same algorithm, otherwise plain
+// frames are sent, so peers without the header keep receiving plain frames.
+// Members of the group are read before Shout sends, peer without support
+// joining the group in between receives compressed frames. Groups whose
+// members may lack support should be sent to by Whisper to each member.
+//
+// Compressed message has frames "ZCOMP/1", algorithm and compressed
+// payload frames.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZCOMP/1"
+
+// Header is the name of header with algorithms supported by the node
+const Header = "X-ZYRE-COMPRESSION"
+
+// Algorithm is a compression algorithm
+type Algorithm string
+
+// Supported algorithms
+const (
+	Zstd   Algorithm = "zstd"
+	Gzip   Algorithm = "gzip"
+	Snappy Algorithm = "snappy"
+)
+
+const (
+	// DefaultMinSize is the size of payload under which it is not compressed
+	DefaultMinSize = 256
+
+	// DefaultMaxSize is the maximum size of decompressed frame
+	DefaultMaxSize = 64 << 20
+)
+
+var (
+	// ErrUnknownAlgorithm is returned for algorithms not supported by the
+	// package
+	ErrUnknownAlgorithm = errors.New("compression: unknown algorithm")
+
+	// ErrTooLarge is returned when decompressed frame exceeds maximum size
+	ErrTooLarge = errors.New("compression: frame too large")
+)
+
+// Advertise returns option of zyre.New which declares algorithms the node
+// decompresses, in order of preference. Without any algorithm all are
+// declared.
+func Advertise(algorithms ...Algorithm) zyre.Option {
+	return func(z *zyre.Node) error {
+		if len(algorithms) == 0 {
+			algorithms = []Algorithm{Zstd, Snappy, Gzip}
+		}
+		names := make([]string, len(algorithms))
+		for i, a := range algorithms {
+			if !a.valid() {
+				return fmt.Errorf("%w: %w: %s", zyre.ErrConfig, ErrUnknownAlgorithm, a)
+			}
+			names[i] = string(a)
+		}
+		err := z.SetHeader(Header, "%s", strings.Join(names, ","))
+		if err != nil && !errors.Is(err, zyre.ErrConfig) {
+			err = fmt.Errorf("%w: %w", zyre.ErrConfig, err)
+		}
+		return err
+	}
+}
+
+func (a Algorithm) valid() bool {
+	return a == Zstd || a == Gzip || a == Snappy
+}
+
+// Sender sends whispers and shouts and knows headers of peers, it is
+// implemented by *zyre.Node
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	Shout(group string, data ...[]byte) error
+	PeersByGroup(group string) []string
+	PeerHeaderValue(peer string, key string) (string, bool)
+}
+
+// Option configures Compressor
+type Option func(*Compressor)
+
+// MinSize sets the total size of payload under which it is sent plain
+func MinSize(size int) Option {
+	return func(c *Compressor) {
+		c.minSize = size
+	}
+}
+
+// MaxSize sets the maximum size of decompressed frame
+func MaxSize(size int) Option {
+	return func(c *Compressor) {
+		if size > 0 {
+			c.maxSize = size
+		}
+	}
+}
+
+// Algorithms sets algorithms used for sending in order of preference, by
+// default zstd, snappy and gzip
+func Algorithms(algorithms ...Algorithm) Option {
+	return func(c *Compressor) {
+		c.algorithms = algorithms
+	}
+}
+
+// Compressor sends compressed payloads and decompresses received ones, it
+// is safe for concurrent use
+type Compressor struct {
+	sender     Sender
+	minSize    int
+	maxSize    int
+	algorithms []Algorithm
+
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// New creates compressor sending by sender (usually *zyre.Node)
+func New(sender Sender, options ...Option) *Compressor {
+	c := &Compressor{
+		sender:     sender,
+		minSize:    DefaultMinSize,
+		maxSize:    DefaultMaxSize,
+		algorithms: []Algorithm{Zstd, Snappy, Gzip},
+	}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+// Whisper sends data to peer, compressed if the peer supports one of
+// algorithms
+func (c *Compressor) Whisper(peer string, data ...[]byte) error {
+	if a, ok := c.choose([]string{peer}, data); ok {
+		frames, err := c.compress(a, data)
+		if err != nil {
+			return err
+		}
+		if frames != nil {
+			return c.sender.Whisper(peer, frames...)
+		}
+	}
+	return c.sender.Whisper(peer, data...)
+}
+
+// Shout sends data to group, compressed if all peers of the group support
+// one of algorithms. Peer joining the group during Shout may receive
+// compressed frames even if it does not support them.
+func (c *Compressor) Shout(group string, data ...[]byte) error {
+	if a, ok := c.choose(c.sender.PeersByGroup(group), data); ok {
+		frames, err := c.compress(a, data)
+		if err != nil {
+			return err
+		}
+		if frames != nil {
+			return c.sender.Shout(group, frames...)
+		}
+	}
+	return c.sender.Shout(group, data...)
+}
+
+// choose returns the first algorithm supported by all peers
+func (c *Compressor) choose(peers []string, data [][]byte) (Algorithm, bool) {
+	size := 0
+	for _, d := range data {
+		size += len(d)
+	}
+	if size < c.minSize || len(peers) == 0 {
+		return "", false
+	}
+	supported := make(map[Algorithm]int)
+	for _, peer := range peers {
+		value, ok := c.sender.PeerHeaderValue(peer, Header)
+		if !ok {
+			return "", false
+		}
+		for _, name := range strings.Split(value, ",") {
+			supported[Algorithm(strings.TrimSpace(name))]++
+		}
+	}
+	for _, a := range c.algorithms {
+		if supported[a] == len(peers) {
+			return a, true
+		}
+	}
+	return "", false
+}
+
+// compress returns frames of compressed message, or nil if compression
+// does not save space
+func (c *Compressor) compress(a Algorithm, data [][]byte) ([][]byte, error) {
+	frames := [][]byte{[]byte(protocol), []byte(a)}
+	plain, compressed := 0, 0
+	for _, d := range data {
+		z, err := c.encode(a, d)
+		if err != nil {
+			return nil, err
+		}
+		plain += len(d)
+		compressed += len(z)
+		frames = append(frames, z)
+	}
+	if compressed >= plain {
+		return nil, nil
+	}
+	return frames, nil
+}
+
+// Decompress returns Whisper or Shout event with decompressed frames, other
+// events and plain messages are returned unchanged
+func (c *Compressor) Decompress(e zyre.Event) (zyre.Event, error) {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		frames, err := c.decompress(m.Message)
+		m.Message = frames
+		return m, err
+	case zyre.Shout:
+		frames, err := c.decompress(m.Message)
+		m.Message = frames
+		return m, err
+	}
+	return e, nil
+}
+
+func (c *Compressor) decompress(frames [][]byte) ([][]byte, error) {
+	if len(frames) < 2 || string(frames[0]) != protocol {
+		return frames, nil
+	}
+	a := Algorithm(frames[1])
+	plain := make([][]byte, 0, len(frames)-2)
+	for _, z := range frames[2:] {
+		d, err := c.decode(a, z)
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, d)
+	}
+	return plain, nil
+}
+
+func (c *Compressor) zstd() {
+	c.once.Do(func() {
+		c.encoder, _ = zstd.NewWriter(nil)
+		c.decoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(c.maxSize)))
+	})
+}
+
+func (c *Compressor) encode(a Algorithm, data []byte) ([]byte, error) {
+	switch a {
+	case Zstd:
+		c.zstd()
+		return c.encoder.EncodeAll(data, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, a)
+}
+
+func (c *Compressor) decode(a Algorithm, data []byte) ([]byte, error) {
+	switch a {
+	case Zstd:
+		c.zstd()
+		d, err := c.decoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrTooLarge
+		}
+		return d, err
+	case Snappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > c.maxSize {
+			return nil, ErrTooLarge
+		}
+		return snappy.Decode(nil, data)
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		d, err := io.ReadAll(io.LimitReader(r, int64(c.maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(d) > c.maxSize {
+			return nil, ErrTooLarge
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, a)
+}
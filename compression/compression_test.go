@@ -0,0 +1,207 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package compression
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+)
+
+// fake records sent frames, it knows headers and groups of peers
+type fake struct {
+	headers map[string]string
+	groups  map[string][]string
+	frames  [][]byte
+}
+
+func (f *fake) Whisper(peer string, data ...[]byte) error {
+	f.frames = data
+	return nil
+}
+
+func (f *fake) Shout(group string, data ...[]byte) error {
+	f.frames = data
+	return nil
+}
+
+func (f *fake) PeersByGroup(group string) []string {
+	return f.groups[group]
+}
+
+func (f *fake) PeerHeaderValue(peer string, key string) (string, bool) {
+	v, ok := f.headers[peer]
+	return v, ok && key == Header
+}
+
+func telemetry() [][]byte {
+	return [][]byte{
+		[]byte("telemetry"),
+		bytes.Repeat([]byte(`{"sensor":"temp","value":21.5}`), 100),
+	}
+}
+
+func TestCompression(t *testing.T) {
+
+	assert := assert.New(t)
+
+	f := &fake{
+		headers: map[string]string{
+			"ZSTD":   "zstd",
+			"GZIP":   "gzip",
+			"SNAPPY": "snappy",
+			"ALL":    "zstd, snappy,gzip",
+		},
+		groups: map[string][]string{
+			"NEW":   {"ALL", "GZIP"},
+			"MIXED": {"ALL", "OLD"},
+			"NONE":  {"ZSTD", "GZIP"},
+		},
+	}
+	c := New(f)
+	data := telemetry()
+
+	for _, peer := range []string{"ZSTD", "GZIP", "SNAPPY"} {
+		assert.NoError(c.Whisper(peer, data...))
+		assert.Equal(protocol, string(f.frames[0]))
+		assert.Equal(f.headers[peer], string(f.frames[1]))
+		assert.Len(f.frames, 4)
+		assert.True(len(f.frames[3]) < len(data[1]))
+		e, err := c.Decompress(zyre.Whisper{Peer: peer, Message: f.frames})
+		assert.NoError(err)
+		assert.Equal(zyre.Whisper{Peer: peer, Message: data}, e)
+	}
+
+	// preference of the sender
+	assert.NoError(c.Whisper("ALL", data...))
+	assert.Equal("zstd", string(f.frames[1]))
+	assert.NoError(New(f, Algorithms(Gzip, Zstd)).Whisper("ALL", data...))
+	assert.Equal("gzip", string(f.frames[1]))
+
+	// old peers receive plain frames
+	assert.NoError(c.Whisper("OLD", data...))
+	assert.Equal(data, f.frames)
+	assert.NoError(c.Shout("MIXED", data...))
+	assert.Equal(data, f.frames)
+
+	// group uses algorithm supported by all peers
+	assert.NoError(c.Shout("NEW", data...))
+	assert.Equal("gzip", string(f.frames[1]))
+	e, err := c.Decompress(zyre.Shout{Group: "NEW", Message: f.frames})
+	assert.NoError(err)
+	assert.Equal(data, e.(zyre.Shout).Message)
+	assert.NoError(c.Shout("NONE", data...))
+	assert.Equal(data, f.frames)
+
+	// small and incompressible payloads are plain
+	assert.NoError(c.Whisper("ZSTD", []byte("small")))
+	assert.Equal([][]byte{[]byte("small")}, f.frames)
+	random := make([]byte, 4096)
+	rand.Read(random)
+	assert.NoError(c.Whisper("ZSTD", random))
+	assert.Equal([][]byte{random}, f.frames)
+
+	// plain messages and other events are unchanged
+	e, err = c.Decompress(zyre.Whisper{Message: data})
+	assert.NoError(err)
+	assert.Equal(zyre.Whisper{Message: data}, e)
+	e, err = c.Decompress(zyre.Join{Peer: "X"})
+	assert.NoError(err)
+	assert.Equal(zyre.Join{Peer: "X"}, e)
+
+	// decompression bombs
+	big := [][]byte{bytes.Repeat([]byte("a"), 1<<20)}
+	limited := New(f, MaxSize(1<<16))
+	for _, peer := range []string{"ZSTD", "GZIP", "SNAPPY"} {
+		assert.NoError(c.Whisper(peer, big...))
+		_, err := limited.Decompress(zyre.Whisper{Message: f.frames})
+		assert.True(errors.Is(err, ErrTooLarge), "%s: %v", peer, err)
+	}
+
+	_, err = c.Decompress(zyre.Whisper{Message: [][]byte{[]byte(protocol), []byte("lz4"), []byte("x")}})
+	assert.True(errors.Is(err, ErrUnknownAlgorithm))
+}
+
+func TestCompressionNodes(t *testing.T) {
+
+	assert := assert.New(t)
+
+	_, err := zyre.New("bad", Advertise("lz4"))
+	assert.True(errors.Is(err, zyre.ErrConfig))
+
+	newNode := func(name string, options ...zyre.Option) (*zyre.Node, <-chan zyre.Event, context.CancelFunc) {
+		node, err := zyre.New(name, append(options, zyre.SetPort(5688))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		events, _ := node.Events(ctx)
+		if err := node.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return node, events, cancel
+	}
+	sender, senderEvents, cancel := newNode("sender", Advertise())
+	defer sender.Destroy()
+	defer cancel()
+	modern, modernEvents, cancel := newNode("modern", Advertise(Gzip))
+	defer modern.Destroy()
+	defer cancel()
+	old, oldEvents, cancel := newNode("old")
+	defer old.Destroy()
+	defer cancel()
+
+	timeout := time.After(5 * time.Second)
+	for entered := 0; entered != 2; {
+		select {
+		case e := <-senderEvents:
+			if e.Type() == zyre.EventEnter {
+				entered++
+			}
+		case <-timeout:
+			t.Fatal("ENTER not received")
+		}
+	}
+	go func() {
+		for range senderEvents {
+		}
+	}()
+
+	whisper := func(events <-chan zyre.Event) zyre.Whisper {
+		for {
+			select {
+			case e := <-events:
+				if w, ok := e.(zyre.Whisper); ok {
+					return w
+				}
+			case <-timeout:
+				t.Fatal("WHISPER not received")
+			}
+		}
+	}
+
+	c := New(sender)
+	data := telemetry()
+	assert.NoError(c.Whisper(modern.UUID(), data...))
+	assert.NoError(c.Whisper(old.UUID(), data...))
+
+	w := whisper(modernEvents)
+	assert.Equal(protocol, string(w.Message[0]))
+	assert.Equal("gzip", string(w.Message[1]))
+	e, err := New(modern).Decompress(w)
+	assert.NoError(err)
+	assert.Equal(data, e.(zyre.Whisper).Message)
+	assert.Equal(data, whisper(oldEvents).Message)
+
+	sender.Stop()
+	modern.Stop()
+	old.Stop()
+}
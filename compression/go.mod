@@ -0,0 +1,14 @@
+module github.com/zeromq/gozyre/compression
+
+go 1.21
+
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/stretchr/testify v1.3.0
+	github.com/zeromq/gozyre v0.0.0-20261017060122-e410551646eb
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -0,0 +1,108 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrent(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5674))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5674))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+	assert.NoError(node.Join("RACE"))
+	assert.NoError(node2.Join("RACE"))
+
+	// wait until node knows node2 is in the group, so messages are not dropped
+	for deadline := time.Now().Add(5 * time.Second); len(node.PeersByGroup("RACE")) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("node2 JOIN not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// node2 sits in blocking Recv until it is stopped
+	received := make(chan int)
+	go func() {
+		n := 0
+		for {
+			m, err := node2.Recv()
+			if err != nil {
+				assert.NoError(err)
+				received <- n
+				return
+			}
+			switch m.(type) {
+			case Whisper, Shout:
+				n++
+			case Stop:
+				received <- n
+				return
+			}
+		}
+	}()
+
+	// node receives with a context, the same way Events and Reactor do
+	ctx, cancel := context.WithCancel(context.Background())
+	var recvWg sync.WaitGroup
+	recvWg.Add(1)
+	go func() {
+		defer recvWg.Done()
+		for ctx.Err() == nil {
+			node.RecvContext(ctx)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i != 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			group := fmt.Sprintf("GROUP%d", i)
+			for j := 0; j != 100; j++ {
+				node.Whisper(node2.UUID(), []byte("whisper"))
+				node.WhisperString(node2.UUID(), "whisper %d", j)
+				node.Shout("RACE", []byte("shout"))
+				node.ShoutString("RACE", "shout %d", j)
+				assert.NoError(node.Join(group))
+				node.Peers()
+				node.PeersByGroup("RACE")
+				node.PeerGroups()
+				node.PeerAddress(node2.UUID())
+				node.PeerHeaderValue(node2.UUID(), "X-HEADER")
+				assert.NoError(node.Leave(group))
+				node.Name()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// let node2 get some of the messages before it is stopped
+	time.Sleep(100 * time.Millisecond)
+	node2.Stop()
+	select {
+	case n := <-received:
+		assert.True(n > 0)
+	case <-time.After(5 * time.Second):
+		t.Fatal("node2 STOP not received")
+	}
+
+	cancel()
+	recvWg.Wait()
+	node.Stop()
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaults of libzyre, used to validate timeouts which are not set
+const (
+	configEvasiveTimeout = 5 * time.Second
+	configExpiredTimeout = 30 * time.Second
+)
+
+// Config is a declarative configuration of a node. Zero values mean defaults
+// of the backend.
+type Config struct {
+	// Name of the node, unique name is generated if empty
+	Name string
+
+	// Port for UDP beacons, 5670 by default
+	Port int
+
+	// Interface for UDP beacons, name or IP address
+	Interface string
+
+	// Interval of UDP beacons, 1s by default
+	Interval time.Duration
+
+	// EvasiveTimeout and ExpiredTimeout of peers, 5s and 30s by default
+	EvasiveTimeout time.Duration
+	ExpiredTimeout time.Duration
+
+	// Headers sent to other nodes during discovery
+	Headers map[string]string
+
+	// Endpoint of node for gossip discovery, eg. "tcp://192.168.1.1:5671".
+	// It requires GossipBind or GossipConnect.
+	Endpoint string
+
+	// GossipBind and GossipConnect are endpoints of gossip discovery
+	GossipBind    string
+	GossipConnect []string
+
+	// Verbose logs all traffic
+	Verbose bool
+}
+
+// Validate checks the configuration, returned errors wrap ErrConfig
+func (c *Config) Validate() error {
+	if err := checkName(c.Name); err != nil {
+		return err
+	}
+	if c.Port != 0 {
+		if err := checkPort(c.Port); err != nil {
+			return err
+		}
+	}
+	if c.Interval != 0 {
+		if err := checkDuration("interval", c.Interval); err != nil {
+			return err
+		}
+	}
+	evasive, expired := configEvasiveTimeout, configExpiredTimeout
+	if c.EvasiveTimeout != 0 {
+		if err := checkDuration("evasive timeout", c.EvasiveTimeout); err != nil {
+			return err
+		}
+		evasive = c.EvasiveTimeout
+	}
+	if c.ExpiredTimeout != 0 {
+		if err := checkDuration("expired timeout", c.ExpiredTimeout); err != nil {
+			return err
+		}
+		expired = c.ExpiredTimeout
+	}
+	if evasive >= expired {
+		return fmt.Errorf("%w: evasive timeout %s must be shorter than expired timeout %s", ErrConfig, evasive, expired)
+	}
+	for name := range c.Headers {
+		if err := checkHeader(name); err != nil {
+			return err
+		}
+	}
+	if c.Endpoint != "" {
+		if err := checkEndpoint("endpoint", c.Endpoint); err != nil {
+			return err
+		}
+		if c.GossipBind == "" && len(c.GossipConnect) == 0 {
+			return fmt.Errorf("%w: endpoint %s requires gossip bind or connect", ErrConfig, c.Endpoint)
+		}
+	}
+	if c.GossipBind != "" {
+		if err := checkEndpoint("gossip bind", c.GossipBind); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.GossipConnect {
+		if err := checkEndpoint("gossip connect", e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Options returns options setting up a node as configured
+func (c *Config) Options() []Option {
+	var options []Option
+	if c.Port != 0 {
+		options = append(options, SetPort(c.Port))
+	}
+	if c.Interface != "" {
+		options = append(options, SetInterface(c.Interface))
+	}
+	if c.Interval != 0 {
+		options = append(options, SetInterval(c.Interval))
+	}
+	if c.EvasiveTimeout != 0 {
+		options = append(options, SetEvasiveTimeout(c.EvasiveTimeout))
+	}
+	if c.ExpiredTimeout != 0 {
+		options = append(options, SetExpiredTimeout(c.ExpiredTimeout))
+	}
+	for name, value := range c.Headers {
+		options = append(options, SetHeader(name, "%s", value))
+	}
+	if c.Verbose {
+		options = append(options, SetVerbose())
+	}
+	if c.Endpoint != "" {
+		endpoint := c.Endpoint
+		options = append(options, func(z *Node) error {
+			return z.SetEndpoint("%s", endpoint)
+		})
+	}
+	if c.GossipBind != "" {
+		bind := c.GossipBind
+		options = append(options, func(z *Node) error {
+			z.GossipBind("%s", bind)
+			return nil
+		})
+	}
+	for _, e := range c.GossipConnect {
+		connect := e
+		options = append(options, func(z *Node) error {
+			z.GossipConnect("%s", connect)
+			return nil
+		})
+	}
+	return options
+}
+
+// NewFromConfig validates the configuration and creates a new zyre.Node
+// from it. Additional options are applied after the configuration.
+func NewFromConfig(c Config, options ...Option) (*Node, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	options = append(c.Options(), options...)
+	if c.Name == "" {
+		return NewUnique(options...)
+	}
+	return New(c.Name, options...)
+}
+
+// checkName checks name of node, ZRE sends it as a short string
+func checkName(name string) error {
+	if len(name) > 255 {
+		return fmt.Errorf("%w: name is longer than 255 bytes", ErrConfig)
+	}
+	return nil
+}
+
+func checkPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%w: port %d is out of range 1-65535", ErrConfig, port)
+	}
+	return nil
+}
+
+// checkDuration checks intervals and timeouts, zyre works with milliseconds
+func checkDuration(what string, d time.Duration) error {
+	if d < time.Millisecond {
+		return fmt.Errorf("%w: %s %s is shorter than 1ms", ErrConfig, what, d)
+	}
+	return nil
+}
+
+// checkHeader checks name of header, ZRE sends it as a short string
+func checkHeader(name string) error {
+	if name == "" || len(name) > 255 {
+		return fmt.Errorf("%w: header name %q must have 1-255 bytes", ErrConfig, name)
+	}
+	return nil
+}
+
+// checkEndpoint checks endpoint has form transport://address
+func checkEndpoint(what, endpoint string) error {
+	i := strings.Index(endpoint, "://")
+	if i <= 0 || i+3 == len(endpoint) {
+		return fmt.Errorf("%w: %s %q is not transport://address", ErrConfig, what, endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package config reads zyre.Config from YAML and TOML files. It is a
+// separate module, so the parsers are not required by gozyre itself,
+// environment variables are read by zyre.ConfigFromEnv.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	zyre "github.com/zeromq/gozyre"
+	"gopkg.in/yaml.v3"
+)
+
+// file is zyre.Config as written in YAML and TOML files
+type file struct {
+	Name           string            `yaml:"name" toml:"name"`
+	Port           int               `yaml:"port" toml:"port"`
+	Interface      string            `yaml:"interface" toml:"interface"`
+	Interval       string            `yaml:"interval" toml:"interval"`
+	EvasiveTimeout string            `yaml:"evasive_timeout" toml:"evasive_timeout"`
+	ExpiredTimeout string            `yaml:"expired_timeout" toml:"expired_timeout"`
+	Headers        map[string]string `yaml:"headers" toml:"headers"`
+	Endpoint       string            `yaml:"endpoint" toml:"endpoint"`
+	GossipBind     string            `yaml:"gossip_bind" toml:"gossip_bind"`
+	GossipConnect  []string          `yaml:"gossip_connect" toml:"gossip_connect"`
+	Verbose        bool              `yaml:"verbose" toml:"verbose"`
+}
+
+// FromFile reads configuration from YAML (.yaml, .yml) or TOML (.toml)
+// file. Keys are lower case names of Config fields separated by underscore,
+// eg. evasive_timeout, durations use time.ParseDuration format and headers
+// are a map. Unknown keys are errors. Configuration is validated, invalid
+// one fails with zyre.ErrConfig.
+func FromFile(path string) (zyre.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return zyre.Config{}, err
+	}
+	var f file
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil && err != io.EOF {
+			return zyre.Config{}, fmt.Errorf("%s: %w: %v", path, zyre.ErrConfig, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &f)
+		if err != nil {
+			return zyre.Config{}, fmt.Errorf("%s: %w: %v", path, zyre.ErrConfig, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return zyre.Config{}, fmt.Errorf("%s: %w: unknown key %s", path, zyre.ErrConfig, undecoded[0])
+		}
+	default:
+		return zyre.Config{}, fmt.Errorf("%s: %w: unknown format %q", path, zyre.ErrConfig, ext)
+	}
+
+	c := zyre.Config{
+		Name:          f.Name,
+		Port:          f.Port,
+		Interface:     f.Interface,
+		Headers:       f.Headers,
+		Endpoint:      f.Endpoint,
+		GossipBind:    f.GossipBind,
+		GossipConnect: f.GossipConnect,
+		Verbose:       f.Verbose,
+	}
+	for _, d := range []struct {
+		name string
+		src  string
+		dst  *time.Duration
+	}{
+		{"interval", f.Interval, &c.Interval},
+		{"evasive_timeout", f.EvasiveTimeout, &c.EvasiveTimeout},
+		{"expired_timeout", f.ExpiredTimeout, &c.ExpiredTimeout},
+	} {
+		if d.src == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.src); err != nil {
+			return zyre.Config{}, fmt.Errorf("%s: %w: %s: invalid duration %q, use eg. \"1500ms\"", path, zyre.ErrConfig, d.name, d.src)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return zyre.Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestFromFile compares configuration read from files in testdata with
+// .golden files. Run go test -update to regenerate golden files.
+func TestFromFile(t *testing.T) {
+
+	inputs, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		ext := filepath.Ext(input)
+		if ext == ".golden" {
+			continue
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+
+			assert := assert.New(t)
+
+			c, err := FromFile(input)
+			got := fmt.Sprintf("%+v\n", c)
+			if err != nil {
+				assert.True(errors.Is(err, zyre.ErrConfig), "%v", err)
+				got = fmt.Sprintf("error: %v\n", err)
+			}
+
+			golden := strings.TrimSuffix(input, ext) + ext + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(string(want), got)
+		})
+	}
+}
+
+func TestFromFileMissing(t *testing.T) {
+	_, err := FromFile("testdata/missing.yaml")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,15 @@
+module github.com/zeromq/gozyre/config
+
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/stretchr/testify v1.3.0
+	github.com/zeromq/gozyre v0.0.0-20261017054944-2334aac2a1d2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -0,0 +1,113 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFromEnv reads configuration from environment variables, names are
+// prefix, underscore and one of NAME, PORT, INTERFACE, INTERVAL,
+// EVASIVE_TIMEOUT, EXPIRED_TIMEOUT, VERBOSE, ENDPOINT, GOSSIP_BIND and
+// GOSSIP_CONNECT (comma separated list). Headers are read from
+// <prefix>_HEADER_<NAME> variables, underscores in NAME are replaced by
+// dashes and double underscores by an underscore, so ZYRE_HEADER_X_SERVICE
+// sets X-SERVICE header and ZYRE_HEADER_X_SERVICE__ID sets X-SERVICE_ID
+// header. Durations use
+// time.ParseDuration format, eg. "1500ms". Configuration is validated.
+func ConfigFromEnv(prefix string) (Config, error) {
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+	var c Config
+	var err error
+	lookup := func(name string) (string, bool) {
+		return os.LookupEnv(prefix + name)
+	}
+	if v, ok := lookup("NAME"); ok {
+		c.Name = v
+	}
+	if v, ok := lookup("PORT"); ok {
+		if c.Port, err = parsePort(prefix+"PORT", v); err != nil {
+			return Config{}, err
+		}
+	}
+	if v, ok := lookup("INTERFACE"); ok {
+		c.Interface = v
+	}
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"INTERVAL", &c.Interval},
+		{"EVASIVE_TIMEOUT", &c.EvasiveTimeout},
+		{"EXPIRED_TIMEOUT", &c.ExpiredTimeout},
+	} {
+		if v, ok := lookup(d.name); ok {
+			if *d.dst, err = parseDuration(prefix+d.name, v); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+	if v, ok := lookup("VERBOSE"); ok {
+		if c.Verbose, err = strconv.ParseBool(v); err != nil {
+			return Config{}, fmt.Errorf("%w: %sVERBOSE: invalid boolean %q", ErrConfig, prefix, v)
+		}
+	}
+	if v, ok := lookup("ENDPOINT"); ok {
+		c.Endpoint = v
+	}
+	if v, ok := lookup("GOSSIP_BIND"); ok {
+		c.GossipBind = v
+	}
+	if v, ok := lookup("GOSSIP_CONNECT"); ok && v != "" {
+		for _, e := range strings.Split(v, ",") {
+			c.GossipConnect = append(c.GossipConnect, strings.TrimSpace(e))
+		}
+	}
+	header := prefix + "HEADER_"
+	for _, kv := range os.Environ() {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv[:i], header) {
+			continue
+		}
+		if c.Headers == nil {
+			c.Headers = make(map[string]string)
+		}
+		c.Headers[envHeader(kv[len(header):i])] = kv[i+1:]
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// envHeader returns header name for NAME part of environment variable,
+// "_" is replaced by "-" and "__" by "_"
+func envHeader(name string) string {
+	parts := strings.Split(name, "__")
+	for i, p := range parts {
+		parts[i] = strings.Replace(p, "_", "-", -1)
+	}
+	return strings.Join(parts, "_")
+}
+
+func parsePort(name, value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%w: %s: invalid port %q, use 1-65535", ErrConfig, name, value)
+	}
+	return port, nil
+}
+
+func parseDuration(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: invalid duration %q, use eg. \"1500ms\"", ErrConfig, name, value)
+	}
+	return d, nil
+}
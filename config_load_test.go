@@ -0,0 +1,75 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestConfigLoad compares configuration read by ConfigFromEnv with prefix
+// GOZYRE from .env files in testdata/config with .golden files. Run go test
+// -update to regenerate golden files.
+func TestConfigLoad(t *testing.T) {
+
+	inputs, err := filepath.Glob("testdata/config/*.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		ext := filepath.Ext(input)
+		t.Run(filepath.Base(input), func(t *testing.T) {
+
+			assert := assert.New(t)
+
+			setenvFile(t, input)
+			c, err := ConfigFromEnv("GOZYRE")
+			got := fmt.Sprintf("%+v\n", c)
+			if err != nil {
+				assert.True(errors.Is(err, ErrConfig), "%v", err)
+				got = fmt.Sprintf("error: %v\n", err)
+			}
+
+			golden := strings.TrimSuffix(input, ext) + ext + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(string(want), got)
+		})
+	}
+}
+
+// setenvFile sets environment variables from KEY=VALUE lines of file for
+// the duration of the test
+func setenvFile(t *testing.T, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) == 2 {
+			t.Setenv(kv[0], kv[1])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+
+	assert := assert.New(t)
+
+	valid := []Config{
+		{},
+		{
+			Name:           "node",
+			Port:           5670,
+			Interface:      "eth0",
+			Interval:       time.Second,
+			EvasiveTimeout: 5 * time.Second,
+			ExpiredTimeout: 30 * time.Second,
+			Headers:        map[string]string{"X-SERVICE": "name"},
+		},
+		{ExpiredTimeout: 10 * time.Second},
+		{
+			Endpoint:      "tcp://192.168.1.1:5671",
+			GossipConnect: []string{"tcp://192.168.1.2:5672"},
+		},
+		{GossipBind: "tcp://*:5672"},
+	}
+	for _, c := range valid {
+		assert.NoError(c.Validate(), "%+v", c)
+	}
+
+	invalid := []Config{
+		{Name: strings.Repeat("n", 256)},
+		{Port: -1},
+		{Port: 65536},
+		{Interval: time.Microsecond},
+		{EvasiveTimeout: -time.Second},
+		{ExpiredTimeout: time.Second},
+		{EvasiveTimeout: 10 * time.Second, ExpiredTimeout: 10 * time.Second},
+		{Headers: map[string]string{"": "value"}},
+		{Endpoint: "tcp://192.168.1.1:5671"},
+		{Endpoint: "192.168.1.1:5671", GossipBind: "tcp://*:5672"},
+		{GossipBind: "tcp://"},
+		{GossipConnect: []string{"://192.168.1.2:5672"}},
+	}
+	for _, c := range invalid {
+		err := c.Validate()
+		assert.True(errors.Is(err, ErrConfig), "%+v: %v", c, err)
+	}
+}
+
+func TestOptionError(t *testing.T) {
+
+	assert := assert.New(t)
+
+	for _, o := range []Option{
+		SetPort(0),
+		SetHeader("", "value"),
+		SetInterval(0),
+		SetEvasiveTimeout(-time.Second),
+		SetExpiredTimeout(time.Nanosecond),
+	} {
+		node, err := New("node", o)
+		assert.Nil(node)
+		assert.True(errors.Is(err, ErrConfig), "%v", err)
+	}
+
+	node, err := NewFromConfig(Config{Port: 70000})
+	assert.Nil(node)
+	assert.True(errors.Is(err, ErrConfig))
+
+	// setters validate the same way as options
+	node = newTestNode(t, "node")
+	for _, err := range []error{
+		node.SetPort(70000),
+		node.SetHeader(strings.Repeat("x", 256), "value"),
+		node.SetInterval(time.Microsecond),
+		node.SetEvasiveTimeout(0),
+		node.SetExpiredTimeout(-time.Second),
+	} {
+		assert.True(errors.Is(err, ErrConfig), "%v", err)
+	}
+	assert.NoError(node.SetPort(5675))
+	node.Destroy()
+
+	node, err = NewFromConfig(Config{
+		Name:    "node",
+		Port:    5675,
+		Headers: map[string]string{"X-SERVICE": "name"},
+	})
+	assert.NoError(err)
+	if node != nil {
+		assert.Equal("node", node.Name())
+		node.Destroy()
+	}
+}
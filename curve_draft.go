@@ -0,0 +1,60 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && !purego && cgo
+// +build draft,!purego,cgo
+
+package zyre
+
+//#cgo pkg-config: libzyre
+//#include<zyre.h>
+import "C"
+
+import (
+	"fmt"
+)
+
+// SetCurveCert - apply a CURVE certificate to the node, all links to peers
+// are encrypted afterwards. Peers without a certificate can't connect to the
+// node. Public key is advertised in X-PUBLICKEY header. An Auth must be
+// running in the process. Has no effect after Start(). Fails with ErrConfig
+// for nil certificate.
+func (z *Node) SetCurveCert(cert *Cert) error {
+	if cert == nil {
+		return fmt.Errorf("%w: nil certificate", ErrConfig)
+	}
+	zcert := cert.zcert()
+	if zcert == nil {
+		return fmt.Errorf("%w: can't create certificate", ErrConfig)
+	}
+	defer C.zcert_destroy(&zcert)
+	z.lock("Node.SetCurveCert")
+	C.zyre_set_zcert(z.ptr, zcert)
+	z.mu.Unlock()
+	return z.SetHeader("X-PUBLICKEY", "%s", cert.PublicText())
+}
+
+// SetCurveCert - option applying a CURVE certificate, see Node.SetCurveCert
+func SetCurveCert(cert *Cert) Option {
+	return func(z *Node) error {
+		return z.SetCurveCert(cert)
+	}
+}
+
+// SetZapDomain - set the ZAP domain used by authenticator for CURVE links
+func (z *Node) SetZapDomain(domain string) {
+	z.lock("Node.SetZapDomain")
+	defer z.mu.Unlock()
+	cdomain, free := cString(domain)
+	defer free()
+	C.zyre_set_zap_domain(z.ptr, cdomain)
+}
+
+// SetZapDomain - option setting the ZAP domain, see Node.SetZapDomain
+func SetZapDomain(domain string) Option {
+	return func(z *Node) error {
+		z.SetZapDomain(domain)
+		return nil
+	}
+}
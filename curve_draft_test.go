@@ -0,0 +1,86 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && !purego && cgo
+// +build draft,!purego,cgo
+
+package zyre
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recvWhisperFrom returns first whisper from peer received by node until timeout
+func recvWhisperFrom(node *Node, peer string, timeout time.Duration) (Whisper, bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		m, err := node.RecvTimeout(time.Until(deadline))
+		if err != nil {
+			continue
+		}
+		if w, ok := m.(Whisper); ok && w.Peer == peer {
+			return w, true
+		}
+	}
+	return Whisper{}, false
+}
+
+func TestCurve(t *testing.T) {
+
+	assert := assert.New(t)
+
+	_, err := New("nil", SetCurveCert(nil))
+	assert.True(errors.Is(err, ErrConfig))
+
+	if !HasCurve() {
+		t.Skip("libzmq has no CURVE support")
+	}
+
+	auth, err := NewAuth()
+	assert.NoError(err)
+	defer auth.Destroy()
+	err = auth.AllowCurve("")
+	assert.NoError(err)
+
+	cert1, err := NewCert()
+	assert.NoError(err)
+	cert2, err := NewCert()
+	assert.NoError(err)
+
+	node1 := newTestNode(t, "curve1", SetPort(5680), SetCurveCert(cert1), SetZapDomain("TEST"))
+	defer node1.Destroy()
+	node2 := newTestNode(t, "curve2", SetPort(5680), SetCurveCert(cert2), SetZapDomain("TEST"))
+	defer node2.Destroy()
+	plain := newTestNode(t, "plain", SetPort(5680))
+	defer plain.Destroy()
+
+	for _, n := range []*Node{node1, node2, plain} {
+		err = n.Start()
+		assert.NoError(err)
+		defer n.Stop()
+	}
+	time.Sleep(1500 * time.Millisecond)
+
+	// encrypted peers meet each other
+	value, ok := node1.PeerHeaderValue(node2.UUID(), "X-PUBLICKEY")
+	assert.True(ok)
+	assert.Equal(cert2.PublicText(), value)
+
+	err = node2.WhisperString(node1.UUID(), "secret")
+	assert.NoError(err)
+	w, ok := recvWhisperFrom(node1, node2.UUID(), 5*time.Second)
+	assert.True(ok)
+	if ok {
+		assert.Equal("secret", string(w.Message[0]))
+	}
+
+	// peer without certificate can't talk to encrypted one
+	plain.WhisperString(node1.UUID(), "clear text")
+	_, ok = recvWhisperFrom(node1, plain.UUID(), 2*time.Second)
+	assert.False(ok)
+}
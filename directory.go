@@ -0,0 +1,214 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Peer is a remote node as seen by Directory
+type Peer struct {
+	UUID     string
+	Name     string
+	Endpoint string
+	Headers  map[string]string
+	// Groups peer is member of, sorted
+	Groups []string
+	// FirstSeen is the time of Enter, LastSeen the time of the last event
+	// from the peer
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Evasive is true after Evasive event, until the peer sends anything
+	Evasive bool
+}
+
+// copy returns deep copy of peer, so callers can't modify the directory
+func (p *Peer) copy() Peer {
+	c := *p
+	c.Headers = make(map[string]string, len(p.Headers))
+	for k, v := range p.Headers {
+		c.Headers[k] = v
+	}
+	c.Groups = append([]string(nil), p.Groups...)
+	return c
+}
+
+// Directory keeps metadata of peers, it is updated by events received from
+// the node. Directory is safe for concurrent use, typically one goroutine
+// calls Update and others query it.
+type Directory struct {
+	mu       sync.RWMutex
+	peers    map[string]*Peer
+	watchers map[*watcher]struct{}
+}
+
+// NewDirectory creates an empty directory
+func NewDirectory() *Directory {
+	return &Directory{
+		peers: make(map[string]*Peer),
+	}
+}
+
+// Update updates the directory from an event. Enter adds the peer and Exit
+// removes it, Join and Leave update groups, Evasive marks the peer evasive
+// and any event updates LastSeen. Stop of own node empties the directory.
+// Leader events are ignored, the leader may be the node itself.
+func (d *Directory) Update(e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.watchers) == 0 {
+		d.update(e)
+		return
+	}
+
+	// compare affected peers before and after the event for watchers
+	affected := []string{e.PeerID()}
+	if _, ok := e.(Stop); ok {
+		affected = affected[:0]
+		for uuid := range d.peers {
+			affected = append(affected, uuid)
+		}
+	}
+	before := d.snapshot(affected)
+	d.update(e)
+	after := d.snapshot(affected)
+	for i := range affected {
+		if before[i] == nil && after[i] == nil {
+			continue
+		}
+		for w := range d.watchers {
+			w.push(peerChange{before[i], after[i]})
+		}
+	}
+}
+
+// snapshot returns copies of peers, nil for peers not in directory
+func (d *Directory) snapshot(uuids []string) []*Peer {
+	peers := make([]*Peer, len(uuids))
+	for i, uuid := range uuids {
+		if p, ok := d.peers[uuid]; ok {
+			c := p.copy()
+			peers[i] = &c
+		}
+	}
+	return peers
+}
+
+func (d *Directory) update(e Event) {
+	if _, ok := e.(Stop); ok {
+		d.peers = make(map[string]*Peer)
+		return
+	}
+	if _, ok := e.(Exit); ok {
+		delete(d.peers, e.PeerID())
+		return
+	}
+	if _, ok := e.(Leader); ok {
+		// Leader is not sent by the peer and it names own node when it
+		// won the election, which must not be added as a peer
+		return
+	}
+
+	at := e.Time()
+	if at.IsZero() {
+		at = time.Now()
+	}
+	p, ok := d.peers[e.PeerID()]
+	if !ok {
+		// Enter may be missed by application which started to read
+		// events late
+		p = &Peer{
+			UUID:      e.PeerID(),
+			Name:      e.PeerName(),
+			Headers:   make(map[string]string),
+			FirstSeen: at,
+		}
+		d.peers[p.UUID] = p
+	}
+	p.LastSeen = at
+	p.Evasive = false
+
+	switch m := e.(type) {
+	case Enter:
+		p.Name = m.Name
+		p.Endpoint = m.Endpoint
+		p.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			p.Headers[k] = v
+		}
+	case Evasive:
+		p.Evasive = true
+	case Join:
+		i := sort.SearchStrings(p.Groups, m.Group)
+		if i == len(p.Groups) || p.Groups[i] != m.Group {
+			p.Groups = append(p.Groups, "")
+			copy(p.Groups[i+1:], p.Groups[i:])
+			p.Groups[i] = m.Group
+		}
+	case Leave:
+		i := sort.SearchStrings(p.Groups, m.Group)
+		if i < len(p.Groups) && p.Groups[i] == m.Group {
+			p.Groups = append(p.Groups[:i], p.Groups[i+1:]...)
+		}
+	}
+}
+
+// Peer returns peer by UUID
+func (d *Directory) Peer(uuid string) (Peer, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	p, ok := d.peers[uuid]
+	if !ok {
+		return Peer{}, false
+	}
+	return p.copy(), true
+}
+
+// Peers returns all peers sorted by UUID
+func (d *Directory) Peers() []Peer {
+	return d.filter(func(*Peer) bool { return true })
+}
+
+// ByName returns peers with the name sorted by UUID, names of nodes
+// do not need to be unique
+func (d *Directory) ByName(name string) []Peer {
+	return d.filter(func(p *Peer) bool { return p.Name == name })
+}
+
+// ByGroup returns peers in the group sorted by UUID
+func (d *Directory) ByGroup(group string) []Peer {
+	return d.filter(func(p *Peer) bool {
+		i := sort.SearchStrings(p.Groups, group)
+		return i < len(p.Groups) && p.Groups[i] == group
+	})
+}
+
+// Len returns the number of peers
+func (d *Directory) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.peers)
+}
+
+func (d *Directory) filter(match func(*Peer) bool) []Peer {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.filter0(match)
+}
+
+// filter0 is filter for callers holding the lock
+func (d *Directory) filter0(match func(*Peer) bool) []Peer {
+	peers := []Peer{}
+	for _, p := range d.peers {
+		if match(p) {
+			peers = append(peers, p.copy())
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].UUID < peers[j].UUID })
+	return peers
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectory(t *testing.T) {
+
+	assert := assert.New(t)
+
+	t0 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDirectory()
+	d.Update(Enter{
+		Peer:     "A",
+		Name:     "printer",
+		Endpoint: "tcp://192.168.1.1:49152",
+		Headers:  map[string]string{"X-SERVICE": "print"},
+		at:       t0,
+	})
+	d.Update(Enter{Peer: "B", Name: "scanner", at: t0})
+	d.Update(Join{Peer: "A", Name: "printer", Group: "OFFICE", at: t0.Add(1 * time.Second)})
+	d.Update(Join{Peer: "A", Name: "printer", Group: "LOBBY", at: t0.Add(2 * time.Second)})
+	d.Update(Join{Peer: "B", Name: "scanner", Group: "OFFICE", at: t0.Add(3 * time.Second)})
+	d.Update(Evasive{Peer: "B", Name: "scanner", at: t0.Add(4 * time.Second)})
+
+	assert.Equal(2, d.Len())
+	a, ok := d.Peer("A")
+	assert.True(ok)
+	assert.Equal(Peer{
+		UUID:      "A",
+		Name:      "printer",
+		Endpoint:  "tcp://192.168.1.1:49152",
+		Headers:   map[string]string{"X-SERVICE": "print"},
+		Groups:    []string{"LOBBY", "OFFICE"},
+		FirstSeen: t0,
+		LastSeen:  t0.Add(2 * time.Second),
+	}, a)
+
+	// returned peer is a copy
+	a.Headers["X-SERVICE"] = "changed"
+	a, _ = d.Peer("A")
+	assert.Equal("print", a.Headers["X-SERVICE"])
+
+	b, _ := d.Peer("B")
+	assert.True(b.Evasive)
+	d.Update(Whisper{Peer: "B", Name: "scanner", at: t0.Add(5 * time.Second)})
+	b, _ = d.Peer("B")
+	assert.False(b.Evasive)
+	assert.Equal(t0.Add(5*time.Second), b.LastSeen)
+
+	uuids := func(peers []Peer) []string {
+		s := []string{}
+		for _, p := range peers {
+			s = append(s, p.UUID)
+		}
+		return s
+	}
+	assert.Equal([]string{"A", "B"}, uuids(d.Peers()))
+	assert.Equal([]string{"A", "B"}, uuids(d.ByGroup("OFFICE")))
+	assert.Equal([]string{"A"}, uuids(d.ByGroup("LOBBY")))
+	assert.Equal([]string{"B"}, uuids(d.ByName("scanner")))
+	assert.Empty(d.ByName("nobody"))
+
+	d.Update(Leave{Peer: "A", Name: "printer", Group: "OFFICE"})
+	assert.Equal([]string{"B"}, uuids(d.ByGroup("OFFICE")))
+
+	// peer seen first by Join, eg. Enter was received before the directory
+	// was set up
+	d.Update(Join{Peer: "C", Name: "late", Group: "LOBBY", at: t0})
+	c, ok := d.Peer("C")
+	assert.True(ok)
+	assert.Equal("late", c.Name)
+	assert.Equal([]string{"LOBBY"}, c.Groups)
+
+	// Leader naming own node does not add it
+	d.Update(Leader{Peer: "SELF", Name: "self", Group: "LOBBY", at: t0})
+	_, ok = d.Peer("SELF")
+	assert.False(ok)
+
+	d.Update(Exit{Peer: "A", Name: "printer"})
+	_, ok = d.Peer("A")
+	assert.False(ok)
+	assert.Equal(2, d.Len())
+
+	d.Update(Stop{})
+	assert.Equal(0, d.Len())
+}
+
+func TestDirectoryConcurrent(t *testing.T) {
+
+	d := NewDirectory()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i != 1000; i++ {
+			d.Update(Enter{Peer: "A", Name: "a"})
+			d.Update(Join{Peer: "A", Name: "a", Group: "G"})
+			d.Update(Exit{Peer: "A", Name: "a"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i != 1000; i++ {
+			d.Peer("A")
+			d.ByGroup("G")
+			d.ByName("a")
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Selector matches headers of peers, nodes announce services they provide
+// in headers
+type Selector func(headers map[string]string) bool
+
+// HeaderEquals selects peers with header equal to value
+func HeaderEquals(name, value string) Selector {
+	return func(headers map[string]string) bool {
+		v, ok := headers[name]
+		return ok && v == value
+	}
+}
+
+// HeaderPrefix selects peers with header starting with prefix
+func HeaderPrefix(name, prefix string) Selector {
+	return func(headers map[string]string) bool {
+		v, ok := headers[name]
+		return ok && strings.HasPrefix(v, prefix)
+	}
+}
+
+// HeaderExists selects peers which have the header
+func HeaderExists(name string) Selector {
+	return func(headers map[string]string) bool {
+		_, ok := headers[name]
+		return ok
+	}
+}
+
+// HeaderVersion selects peers with semantic version in header matching the
+// range, eg. ">=1.2.0 <2.0.0", "^1.4", "~1.4.2" or "1.0.0 || ^2.1". Peers
+// with invalid version do not match. Pre-release version matches only range
+// naming pre-release of the same version, eg. 1.3.0-rc.2 matches
+// ">=1.3.0-rc.1" but not ">=1.2.0". Returns error for invalid range.
+func HeaderVersion(name, constraint string) (Selector, error) {
+	r, err := parseRange(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("HeaderVersion: %v", err)
+	}
+	return func(headers map[string]string) bool {
+		s, ok := headers[name]
+		if !ok {
+			return false
+		}
+		v, err := parseVersion(s)
+		return err == nil && r.match(v)
+	}, nil
+}
+
+// All selects peers matched by all selectors
+func All(selectors ...Selector) Selector {
+	return func(headers map[string]string) bool {
+		for _, s := range selectors {
+			if !s(headers) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any selects peers matched by at least one selector
+func Any(selectors ...Selector) Selector {
+	return func(headers map[string]string) bool {
+		for _, s := range selectors {
+			if s(headers) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Find returns peers matched by selector sorted by UUID. Selector is called
+// on copies of peers without holding the lock, so it may query the directory.
+func (d *Directory) Find(selector Selector) []Peer {
+	peers := []Peer{}
+	for _, p := range d.Peers() {
+		if selector(p.Headers) {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// ServiceChange is a kind of ServiceEvent
+type ServiceChange int
+
+// Changes of services reported by Watch
+const (
+	ServiceAdded ServiceChange = iota + 1
+	ServiceRemoved
+	ServiceChanged
+)
+
+var serviceChangeNames = map[ServiceChange]string{
+	ServiceAdded:   "ADDED",
+	ServiceRemoved: "REMOVED",
+	ServiceChanged: "CHANGED",
+}
+
+func (c ServiceChange) String() string {
+	if s, ok := serviceChangeNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("ServiceChange(%d)", int(c))
+}
+
+// ServiceEvent reports peer which started or stopped to match selector of
+// Watch, or matching peer whose name, endpoint or headers changed
+type ServiceEvent struct {
+	Change ServiceChange
+	Peer   Peer
+}
+
+// Watch returns channel of changes of peers matched by selector. Peers
+// matching when Watch is called are reported as ServiceAdded first. Events
+// are queued, so slow reader does not block Update. The channel is closed
+// when ctx is done. Selector is called by the goroutine of Watch, not by
+// Update.
+func (d *Directory) Watch(ctx context.Context, selector Selector) <-chan ServiceEvent {
+	w := &watcher{
+		signal: make(chan struct{}, 1),
+	}
+	out := make(chan ServiceEvent)
+
+	d.mu.Lock()
+	for _, p := range d.filter0(func(*Peer) bool { return true }) {
+		p := p
+		w.push(peerChange{nil, &p})
+	}
+	if d.watchers == nil {
+		d.watchers = make(map[*watcher]struct{})
+	}
+	d.watchers[w] = struct{}{}
+	d.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer func() {
+			d.mu.Lock()
+			delete(d.watchers, w)
+			d.mu.Unlock()
+		}()
+		for {
+			for _, c := range w.pop() {
+				e, ok := c.serviceEvent(selector)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-w.signal:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// watcher queues changes of peers for Watch
+type watcher struct {
+	signal chan struct{}
+
+	mu      sync.Mutex
+	pending []peerChange
+}
+
+// peerChange is state of a peer before and after an event, nil if peer is
+// not in directory
+type peerChange struct {
+	before, after *Peer
+}
+
+func (w *watcher) push(c peerChange) {
+	w.mu.Lock()
+	w.pending = append(w.pending, c)
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) pop() []peerChange {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending := w.pending
+	w.pending = nil
+	return pending
+}
+
+// serviceEvent returns event reporting the change to watcher with selector,
+// ok is false if the change is not visible to the watcher
+func (c peerChange) serviceEvent(selector Selector) (e ServiceEvent, ok bool) {
+	mb := c.before != nil && selector(c.before.Headers)
+	ma := c.after != nil && selector(c.after.Headers)
+	switch {
+	case !mb && ma:
+		return ServiceEvent{ServiceAdded, *c.after}, true
+	case mb && !ma:
+		return ServiceEvent{ServiceRemoved, *c.before}, true
+	case mb && ma && !samePeerService(c.before, c.after):
+		return ServiceEvent{ServiceChanged, *c.after}, true
+	}
+	return ServiceEvent{}, false
+}
+
+// samePeerService compares properties of peer describing service
+func samePeerService(a, b *Peer) bool {
+	if a.Name != b.Name || a.Endpoint != b.Endpoint || len(a.Headers) != len(b.Headers) {
+		return false
+	}
+	for k, v := range a.Headers {
+		if w, ok := b.Headers[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionRange(t *testing.T) {
+
+	assert := assert.New(t)
+
+	tests := []struct {
+		constraint string
+		version    string
+		match      bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"=1.2", "1.2.0", true},
+		{"1.2.3", "v1.2.3+build", true},
+		{"!=1.2.3", "1.2.3", false},
+		{">=1.2.0 <2.0.0", "1.9.9", true},
+		{">=1.2.0 <2.0.0", "2.0.0", false},
+		{">=1.2.0, <2.0.0", "1.1.9", false},
+		{">1.2.3", "1.2.4-alpha", false},
+		{"<=1.2.3", "1.2.3-rc.1", false},
+		{">=1.2.0 <2.0.0", "1.3.0-rc1", false},
+		{">=1.3.0-rc.1 <2.0.0", "1.3.0-rc.2", true},
+		{">=1.3.0-rc.1 <2.0.0", "1.4.0-rc.1", false},
+		{"1.2.0 || >=1.3.0-rc.1", "1.3.0-rc.2", true},
+		{">1.2.3-rc.1", "1.2.3", true},
+		{"^1.4", "1.9.0", true},
+		{"^1.4", "2.0.0", false},
+		{"^1.4", "2.0.0-alpha", false},
+		{"^1.4", "1.3.9", false},
+		{"^0.3.1", "0.3.9", true},
+		{"^0.3.1", "0.4.0", false},
+		{"^0.0.3", "0.0.3", true},
+		{"^0.0.3", "0.0.4", false},
+		{"^0.0.3", "0.1.0", false},
+		{"^0.0", "0.0.9", true},
+		{"^0.0", "0.1.0", false},
+		{"^0", "0.9.0", true},
+		{"^0", "1.0.0", false},
+		{"~1.4.2", "1.4.9", true},
+		{"~1.4.2", "1.5.0", false},
+		{"1.0.0 || ^2.1", "1.0.0", true},
+		{"1.0.0 || ^2.1", "2.5.0", true},
+		{"1.0.0 || ^2.1", "1.5.0", false},
+		{">=1.0.0-alpha.2", "1.0.0-alpha.10", true},
+		{">=1.0.0-alpha.beta", "1.0.0-alpha.10", false},
+	}
+	for _, tt := range tests {
+		r, err := parseRange(tt.constraint)
+		if !assert.NoError(err, tt.constraint) {
+			continue
+		}
+		v, err := parseVersion(tt.version)
+		if !assert.NoError(err, tt.version) {
+			continue
+		}
+		assert.Equal(tt.match, r.match(v), "%s matches %s", tt.constraint, tt.version)
+	}
+
+	for _, constraint := range []string{"", "1.2.3.4", ">=x", "1.0 ||", "^"} {
+		_, err := parseRange(constraint)
+		assert.Error(err, constraint)
+	}
+}
+
+func TestSelector(t *testing.T) {
+
+	assert := assert.New(t)
+
+	headers := map[string]string{
+		"X-SERVICE": "printer.color",
+		"X-VERSION": "1.4.2",
+	}
+	assert.True(HeaderEquals("X-SERVICE", "printer.color")(headers))
+	assert.False(HeaderEquals("X-SERVICE", "printer")(headers))
+	assert.True(HeaderPrefix("X-SERVICE", "printer.")(headers))
+	assert.False(HeaderPrefix("X-MISSING", "")(headers))
+	assert.True(HeaderExists("X-VERSION")(headers))
+	assert.False(HeaderExists("X-MISSING")(headers))
+
+	version, err := HeaderVersion("X-VERSION", "^1.2")
+	assert.NoError(err)
+	assert.True(version(headers))
+	assert.False(version(map[string]string{"X-VERSION": "garbage"}))
+	_, err = HeaderVersion("X-VERSION", ">=")
+	assert.Error(err)
+
+	assert.True(All(HeaderExists("X-SERVICE"), version)(headers))
+	assert.False(All(HeaderExists("X-MISSING"), version)(headers))
+	assert.True(Any(HeaderExists("X-MISSING"), version)(headers))
+	assert.False(Any()(headers))
+}
+
+func TestWatch(t *testing.T) {
+
+	assert := assert.New(t)
+
+	d := NewDirectory()
+	d.Update(Enter{Peer: "A", Name: "a", Headers: map[string]string{"X-SERVICE": "printer"}})
+	d.Update(Enter{Peer: "B", Name: "b", Headers: map[string]string{"X-SERVICE": "scanner"}})
+
+	printers := HeaderEquals("X-SERVICE", "printer")
+	found := d.Find(printers)
+	assert.Len(found, 1)
+	assert.Equal("A", found[0].UUID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := d.Watch(ctx, printers)
+	next := func() ServiceEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no service event")
+		}
+		return ServiceEvent{}
+	}
+
+	e := next()
+	assert.Equal(ServiceAdded, e.Change)
+	assert.Equal("A", e.Peer.UUID)
+
+	// events not changing matched services are not reported
+	d.Update(Join{Peer: "A", Name: "a", Group: "G"})
+	d.Update(Enter{Peer: "C", Name: "c", Headers: map[string]string{"X-SERVICE": "scanner"}})
+	d.Update(Enter{Peer: "D", Name: "d", Headers: map[string]string{"X-SERVICE": "printer"}})
+	e = next()
+	assert.Equal(ServiceAdded, e.Change)
+	assert.Equal("D", e.Peer.UUID)
+
+	d.Update(Enter{Peer: "D", Name: "d", Headers: map[string]string{"X-SERVICE": "printer", "X-COLOR": "yes"}})
+	e = next()
+	assert.Equal(ServiceChanged, e.Change)
+	assert.Equal("yes", e.Peer.Headers["X-COLOR"])
+
+	d.Update(Exit{Peer: "A", Name: "a"})
+	e = next()
+	assert.Equal(ServiceRemoved, e.Change)
+	assert.Equal("A", e.Peer.UUID)
+
+	d.Update(Stop{})
+	e = next()
+	assert.Equal(ServiceRemoved, e.Change)
+	assert.Equal("D", e.Peer.UUID)
+	assert.Equal("REMOVED", e.Change.String())
+
+	cancel()
+	for range events {
+	}
+	d.mu.RLock()
+	assert.Empty(d.watchers)
+	d.mu.RUnlock()
+
+	// selectors are called without the lock, so they may query the directory
+	d.Update(Enter{Peer: "E", Name: "e", Headers: map[string]string{"X-SERVICE": "printer"}})
+	querying := func(headers map[string]string) bool {
+		return d.Len() > 0 && printers(headers)
+	}
+	assert.Len(d.Find(querying), 1)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events = d.Watch(ctx, querying)
+	assert.Equal("E", next().Peer.UUID)
+	d.Update(Enter{Peer: "F", Name: "f", Headers: map[string]string{"X-SERVICE": "printer"}})
+	assert.Equal("F", next().Peer.UUID)
+}
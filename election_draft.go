@@ -0,0 +1,61 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && !purego && cgo
+// +build draft,!purego,cgo
+
+package zyre
+
+//#cgo pkg-config: libzyre
+//#include<zyre.h>
+import "C"
+
+import (
+	"fmt"
+)
+
+// ContestInGroup - enforce leader election in group. Election starts when
+// the node joins the group, so call it before Join. The winner is announced
+// by Leader event to all contesting nodes. Fails with ErrConfig for empty
+// group or group longer than 255 bytes.
+func (z *Node) ContestInGroup(group string) error {
+	if group == "" || len(group) > 255 {
+		return fmt.Errorf("%w: group name %q must have 1-255 bytes", ErrConfig, group)
+	}
+	z.lock("Node.ContestInGroup")
+	defer z.mu.Unlock()
+	cgroup, free := cString(group)
+	defer free()
+	C.zyre_set_contest_in_group(z.ptr, cgroup)
+	return nil
+}
+
+// ContestInGroup - option enforcing leader election in group, see
+// Node.ContestInGroup
+func ContestInGroup(group string) Option {
+	return func(z *Node) error {
+		return z.ContestInGroup(group)
+	}
+}
+
+// GroupLeader - return UUID of current leader of group, as announced by the
+// last Leader event received by Recv. Returns ok false if no leader is known
+// or the leader has left the group or the network.
+func (z *Node) GroupLeader(group string) (peer string, ok bool) {
+	z.trackMu.Lock()
+	defer z.trackMu.Unlock()
+	peer, ok = z.leaders[group]
+	return
+}
+
+// Leaders - return current leaders of all groups, see GroupLeader
+func (z *Node) Leaders() map[string]string {
+	z.trackMu.Lock()
+	defer z.trackMu.Unlock()
+	leaders := make(map[string]string, len(z.leaders))
+	for group, peer := range z.leaders {
+		leaders[group] = peer
+	}
+	return leaders
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && !purego && cgo
+// +build draft,!purego,cgo
+
+package zyre
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElection(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node1 := newTestNode(t, "leader1", SetPort(5681), ContestInGroup("ELECTION"))
+	defer node1.Destroy()
+	node2 := newTestNode(t, "leader2", SetPort(5681), ContestInGroup("ELECTION"))
+	defer node2.Destroy()
+
+	for _, n := range []*Node{node1, node2} {
+		err := n.Start()
+		assert.NoError(err)
+		defer n.Stop()
+		err = n.Join("ELECTION")
+		assert.NoError(err)
+	}
+
+	leaders := make([]string, 2)
+	for i, n := range []*Node{node1, node2} {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			m, err := n.RecvTimeout(time.Until(deadline))
+			if err != nil {
+				continue
+			}
+			if l, ok := m.(Leader); ok {
+				assert.Equal("ELECTION", l.Group)
+				leaders[i] = l.Peer
+				break
+			}
+		}
+		leader, ok := n.GroupLeader("ELECTION")
+		assert.True(ok)
+		assert.Equal(leaders[i], leader)
+	}
+	assert.NotEmpty(leaders[0])
+	assert.Equal(leaders[0], leaders[1])
+	assert.Contains([]string{node1.UUID(), node2.UUID()}, leaders[0])
+
+	err := node1.Leave("ELECTION")
+	assert.NoError(err)
+	_, ok := node1.GroupLeader("ELECTION")
+	assert.False(ok)
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && (purego || !cgo)
+// +build draft
+// +build purego !cgo
+
+package zyre
+
+// Leader election of the draft API is not implemented by the pure Go
+// backend, it is rejected explicitly, so applications do not wait for
+// Leader events which never come.
+
+// ContestInGroup - leader election is not supported by the pure Go backend,
+// always returns ErrNotSupported
+func (z *Node) ContestInGroup(group string) error {
+	return ErrNotSupported
+}
+
+// ContestInGroup - option enforcing leader election in group, New fails with
+// ErrNotSupported on the pure Go backend
+func ContestInGroup(group string) Option {
+	return func(z *Node) error {
+		return z.ContestInGroup(group)
+	}
+}
+
+// GroupLeader - return UUID of current leader of group, there is never one
+// on the pure Go backend
+func (z *Node) GroupLeader(group string) (peer string, ok bool) {
+	return "", false
+}
+
+// Leaders - return current leaders of all groups, always empty on the pure
+// Go backend
+func (z *Node) Leaders() map[string]string {
+	return map[string]string{}
+}
@@ -0,0 +1,30 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build draft && (purego || !cgo)
+// +build draft
+// +build purego !cgo
+
+package zyre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElectionNotSupported(t *testing.T) {
+
+	assert := assert.New(t)
+
+	_, err := New("leader", ContestInGroup("ELECTION"))
+	assert.Equal(ErrNotSupported, err)
+
+	node := newTestNode(t, "node")
+	defer node.Destroy()
+	assert.Equal(ErrNotSupported, node.ContestInGroup("ELECTION"))
+	_, ok := node.GroupLeader("ELECTION")
+	assert.False(ok)
+	assert.Empty(node.Leaders())
+}
@@ -0,0 +1,260 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType identifies the kind of Event
+type EventType int
+
+// Types of events received from the network
+const (
+	EventEnter EventType = iota + 1
+	EventEvasive
+	EventExit
+	EventJoin
+	EventLeave
+	EventWhisper
+	EventShout
+	EventStop
+	EventLeader
+)
+
+var eventTypeNames = map[EventType]string{
+	EventEnter:   "ENTER",
+	EventEvasive: "EVASIVE",
+	EventExit:    "EXIT",
+	EventJoin:    "JOIN",
+	EventLeave:   "LEAVE",
+	EventWhisper: "WHISPER",
+	EventShout:   "SHOUT",
+	EventStop:    "STOP",
+	EventLeader:  "LEADER",
+}
+
+// String returns the name of event as used by libzyre, eg. "ENTER"
+func (t EventType) String() string {
+	if s, ok := eventTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a message received from the network, it is one of Enter, Evasive,
+// Exit, Join, Leave, Whisper, Shout, Stop or Leader. The interface is sealed,
+// it can't be implemented outside this package.
+type Event interface {
+	// PeerID returns UUID of peer which caused the event
+	PeerID() string
+	// PeerName returns name of peer which caused the event
+	PeerName() string
+	// Type returns type of the event
+	Type() EventType
+	// Time returns the time event was received, zero for events
+	// not created by Recv
+	Time() time.Time
+
+	isEvent()
+}
+
+// Enter - new peer has entered the network
+type Enter struct {
+	Peer     string
+	Name     string
+	Headers  map[string]string
+	Endpoint string
+	at       time.Time
+}
+
+// Evasive - peer is being evasive (quiet for too long)
+type Evasive struct {
+	Peer string
+	Name string
+	at   time.Time
+}
+
+// Exit - peer has left the network
+type Exit struct {
+	Peer string
+	Name string
+	at   time.Time
+}
+
+// Join - peer has joined a specific group
+type Join struct {
+	Peer  string
+	Name  string
+	Group string
+	at    time.Time
+}
+
+// Leave - peer has left a specific group
+type Leave struct {
+	Peer  string
+	Name  string
+	Group string
+	at    time.Time
+}
+
+// Whisper -  peer has sent this node a message
+type Whisper struct {
+	Peer    string
+	Name    string
+	Message [][]byte
+	at      time.Time
+}
+
+// Shout -  a peer has sent one of our groups a message
+type Shout struct {
+	Peer    string
+	Name    string
+	Group   string
+	Message [][]byte
+	at      time.Time
+}
+
+// Stop - peer was stopped
+type Stop struct {
+	Peer string
+	Name string
+	at   time.Time
+}
+
+// Leader - peer has won the election in a group, see Node.ContestInGroup
+type Leader struct {
+	Peer  string
+	Name  string
+	Group string
+	at    time.Time
+}
+
+// PeerID returns UUID of peer
+func (m Enter) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Enter) PeerName() string { return m.Name }
+
+// Type returns EventEnter
+func (m Enter) Type() EventType { return EventEnter }
+
+// Time returns the time event was received
+func (m Enter) Time() time.Time { return m.at }
+
+func (Enter) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Evasive) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Evasive) PeerName() string { return m.Name }
+
+// Type returns EventEvasive
+func (m Evasive) Type() EventType { return EventEvasive }
+
+// Time returns the time event was received
+func (m Evasive) Time() time.Time { return m.at }
+
+func (Evasive) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Exit) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Exit) PeerName() string { return m.Name }
+
+// Type returns EventExit
+func (m Exit) Type() EventType { return EventExit }
+
+// Time returns the time event was received
+func (m Exit) Time() time.Time { return m.at }
+
+func (Exit) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Join) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Join) PeerName() string { return m.Name }
+
+// Type returns EventJoin
+func (m Join) Type() EventType { return EventJoin }
+
+// Time returns the time event was received
+func (m Join) Time() time.Time { return m.at }
+
+func (Join) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Leave) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Leave) PeerName() string { return m.Name }
+
+// Type returns EventLeave
+func (m Leave) Type() EventType { return EventLeave }
+
+// Time returns the time event was received
+func (m Leave) Time() time.Time { return m.at }
+
+func (Leave) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Whisper) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Whisper) PeerName() string { return m.Name }
+
+// Type returns EventWhisper
+func (m Whisper) Type() EventType { return EventWhisper }
+
+// Time returns the time event was received
+func (m Whisper) Time() time.Time { return m.at }
+
+func (Whisper) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Shout) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Shout) PeerName() string { return m.Name }
+
+// Type returns EventShout
+func (m Shout) Type() EventType { return EventShout }
+
+// Time returns the time event was received
+func (m Shout) Time() time.Time { return m.at }
+
+func (Shout) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Stop) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Stop) PeerName() string { return m.Name }
+
+// Type returns EventStop
+func (m Stop) Type() EventType { return EventStop }
+
+// Time returns the time event was received
+func (m Stop) Time() time.Time { return m.at }
+
+func (Stop) isEvent() {}
+
+// PeerID returns UUID of peer
+func (m Leader) PeerID() string { return m.Peer }
+
+// PeerName returns name of peer
+func (m Leader) PeerName() string { return m.Name }
+
+// Type returns EventLeader
+func (m Leader) Type() EventType { return EventLeader }
+
+// Time returns the time event was received
+func (m Leader) Time() time.Time { return m.at }
+
+func (Leader) isEvent() {}
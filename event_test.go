@@ -0,0 +1,37 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvent(t *testing.T) {
+
+	assert := assert.New(t)
+
+	events := []Event{
+		Enter{Peer: "uuid", Name: "name"},
+		Evasive{Peer: "uuid", Name: "name"},
+		Exit{Peer: "uuid", Name: "name"},
+		Join{Peer: "uuid", Name: "name"},
+		Leave{Peer: "uuid", Name: "name"},
+		Whisper{Peer: "uuid", Name: "name"},
+		Shout{Peer: "uuid", Name: "name"},
+		Stop{Peer: "uuid", Name: "name"},
+		Leader{Peer: "uuid", Name: "name"},
+	}
+	names := []string{"ENTER", "EVASIVE", "EXIT", "JOIN", "LEAVE", "WHISPER", "SHOUT", "STOP", "LEADER"}
+
+	for i, e := range events {
+		assert.Equal("uuid", e.PeerID())
+		assert.Equal("name", e.PeerName())
+		assert.Equal(names[i], e.Type().String())
+		assert.True(e.Time().IsZero())
+	}
+	assert.Equal("EventType(0)", EventType(0).String())
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"context"
+)
+
+// DefaultEventsBuffer is the capacity of the channel returned by Node.Events
+// unless EventsBuffer option says otherwise
+const DefaultEventsBuffer = 64
+
+// EventsOption is a type for tuning the stream returned by Node.Events
+type EventsOption func(*eventsConfig)
+
+type eventsConfig struct {
+	buffer int
+}
+
+// EventsBuffer - set the capacity of events channel. Zero means unbuffered
+// channel, negative values are treated as zero.
+func EventsBuffer(size int) EventsOption {
+	return func(c *eventsConfig) {
+		if size < 0 {
+			size = 0
+		}
+		c.buffer = size
+	}
+}
+
+// Events - starts a goroutine which receives messages from the node and
+// returns them as a channel of events and a channel of errors. The goroutine
+// is owned by the library and it closes both channels when ctx is done or
+// when the node can't receive anymore (ErrRecvNil or ErrPoll, which are sent
+// to errors channel first). Other errors (a malformed message) are sent to
+// errors channel and receiving continues.
+//
+// Overflow: when events channel is full, the goroutine waits until there is
+// a space or ctx is done. Nothing is dropped by the library, incoming
+// messages are queued by libzyre in the meantime. Errors channel is not
+// buffered, so consumers must read both channels.
+//
+// Shutdown: cancel ctx and drain the channels, or destroy the node, which
+// interrupts pending receive. After Destroy ErrRecvNil is sent to errors
+// channel, unless ctx is already done, and both channels are closed.
+func (z *Node) Events(ctx context.Context, options ...EventsOption) (<-chan Event, <-chan error) {
+	cfg := eventsConfig{
+		buffer: DefaultEventsBuffer,
+	}
+	for _, o := range options {
+		o(&cfg)
+	}
+
+	events := make(chan Event, cfg.buffer)
+	errs := make(chan error)
+	go func() {
+		defer close(errs)
+		defer close(events)
+		for {
+			m, err := z.RecvContext(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+				if err == ErrRecvNil || err == ErrPoll {
+					return
+				}
+				continue
+			}
+			select {
+			case events <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, errs
+}
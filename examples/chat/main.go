@@ -5,37 +5,37 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 
 	zyre "github.com/zeromq/gozyre"
 )
 
-func chatActor(pipe chan string, name string) {
+func chatActor(pipe chan string, done chan struct{}, name string) {
+	defer close(done)
 
-	node := zyre.New(
+	node, err := zyre.New(
 		name,
 	)
+	if err != nil {
+		panic(err)
+	}
 	node.Start()
-	err := node.Join("CHAT")
-
-	zyreChan := make(chan interface{})
-	go func() {
-		for {
-			msg, err := node.Recv()
-			if err != nil {
-				panic(err)
-			}
-			zyreChan <- msg
-		}
-	}()
-
+	err = node.Join("CHAT")
 	if err != nil {
 		panic(err)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := node.Events(ctx)
+
+loop:
 	for {
 		select {
-		case msg := <-zyreChan:
+		case err := <-errs:
+			panic(err)
+		case msg := <-events:
 			switch msg.(type) {
 			case zyre.Join:
 				msg := msg.(zyre.Join)
@@ -52,12 +52,16 @@ func chatActor(pipe chan string, name string) {
 			}
 		case shout := <-pipe:
 			if shout == "$TERM" {
-				break
+				break loop
 			}
-			node.ShoutString("CHAT", shout)
+			node.ShoutString("CHAT", "%s", shout)
 		}
 	}
 
+	// stop the receiving goroutine before the node goes away under it
+	cancel()
+	for range events {
+	}
 	node.Stop()
 	node.Destroy()
 }
@@ -66,7 +70,8 @@ func main() {
 
 	name := os.Args[1]
 	pipe := make(chan string)
-	go chatActor(pipe, name)
+	done := make(chan struct{})
+	go chatActor(pipe, done, name)
 
 	inp := bufio.NewScanner(os.Stdin)
 	for inp.Scan() {
@@ -74,4 +79,5 @@ func main() {
 	}
 
 	pipe <- "$TERM"
+	<-done
 }
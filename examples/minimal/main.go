@@ -20,10 +20,13 @@ func main() {
 	flag.Parse()
 
     println("D: BAF2")
-	node := zyre.New(name)
+	node, err := zyre.New(name)
+	if err != nil {
+		panic(err)
+	}
 	defer node.Destroy()
 
-	err := node.Start()
+	err = node.Start()
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,162 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package filetransfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// message is a reply of peer to Fetch, args are after id
+type message struct {
+	kind string
+	args [][]byte
+}
+
+// download is a file fetched from peer
+type download struct {
+	peer   string
+	msgs   chan message
+	exited chan struct{}
+	once   sync.Once
+}
+
+func (d *download) deliver(m message) {
+	select {
+	case d.msgs <- m:
+	default:
+		// peer does not respect the window, Fetch fails on missing data
+	}
+}
+
+func (d *download) exit() {
+	d.once.Do(func() { close(d.exited) })
+}
+
+// Fetch requests file name from peer and stores it at path. Data are
+// written to path + ".part" first, which is renamed to path when the
+// checksum matches. If Fetch is cancelled or the peer exits, the part file
+// is kept and next Fetch continues from its end. Concurrent fetches must
+// use different paths.
+func (s *Service) Fetch(ctx context.Context, peer, name, path string) error {
+	if _, ok := s.sender.PeerAddress(peer); !ok {
+		return ErrUnknownPeer
+	}
+	part := path + ".part"
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Service.Fetch: %w", err)
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("Service.Fetch: %w", err)
+	}
+
+	id := s.nextID()
+	d := &download{
+		peer:   peer,
+		msgs:   make(chan message, s.window+2),
+		exited: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.fetches[id] = d
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.fetches, id)
+		s.mu.Unlock()
+	}()
+
+	err = s.sender.Whisper(peer, frames(kindGet, id, name,
+		strconv.FormatInt(offset, 10), strconv.Itoa(s.window))...)
+	if err != nil {
+		return err
+	}
+
+	size := int64(-1)
+	var sum string
+	for size < 0 || offset < size {
+		var m message
+		select {
+		case <-ctx.Done():
+			s.sender.Whisper(peer, frames(kindCancel, id)...)
+			return ctx.Err()
+		case <-d.exited:
+			return ErrPeerExit
+		case m = <-d.msgs:
+		}
+		switch m.kind {
+		case kindErr:
+			if len(m.args) == 2 && string(m.args[0]) == codeNotFound {
+				return ErrNotFound
+			}
+			if len(m.args) == 2 {
+				return fmt.Errorf("filetransfer: %s: %s", name, m.args[1])
+			}
+			return ErrProtocol
+		case kindInfo:
+			if len(m.args) != 2 {
+				return s.abort(peer, id, ErrProtocol)
+			}
+			size, err = strconv.ParseInt(string(m.args[0]), 10, 64)
+			if err != nil || size < 0 {
+				return s.abort(peer, id, ErrProtocol)
+			}
+			sum = string(m.args[1])
+			if offset > size {
+				// file changed since the part was written
+				f.Close()
+				os.Remove(part)
+				return ErrChecksum
+			}
+		case kindData:
+			if size < 0 || len(m.args) != 2 {
+				return s.abort(peer, id, ErrProtocol)
+			}
+			at, err := strconv.ParseInt(string(m.args[0]), 10, 64)
+			data := m.args[1]
+			if err != nil || at != offset || offset+int64(len(data)) > size {
+				return s.abort(peer, id, ErrProtocol)
+			}
+			if _, err := f.WriteAt(data, offset); err != nil {
+				s.abort(peer, id, err)
+				return fmt.Errorf("Service.Fetch: %w", err)
+			}
+			offset += int64(len(data))
+			s.sender.Whisper(peer, frames(kindAck, id, strconv.FormatInt(offset, 10))...)
+			if s.progress != nil {
+				s.progress(Progress{Peer: peer, Name: name, Transferred: offset, Size: size})
+			}
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("Service.Fetch: %w", err)
+	}
+	_, got, err := checksumReader(f)
+	if err != nil {
+		return fmt.Errorf("Service.Fetch: %w", err)
+	}
+	f.Close()
+	if got != sum {
+		os.Remove(part)
+		return ErrChecksum
+	}
+	if err := os.Rename(part, path); err != nil {
+		return fmt.Errorf("Service.Fetch: %w", err)
+	}
+	return nil
+}
+
+// abort cancels transfer id at peer
+func (s *Service) abort(peer, id string, err error) error {
+	s.sender.Whisper(peer, frames(kindCancel, id)...)
+	return err
+}
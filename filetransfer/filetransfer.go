@@ -0,0 +1,325 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package filetransfer offers, requests and streams files between zyre peers
+// over Whisper.
+//
+// Transfers are driven by the receiving peer. All messages are whispers
+// starting with frame "ZFILE/1" and a kind:
+//
+//	OFFER name size sum    file is available
+//	GET id name offset n   request file from offset, n chunks unacknowledged
+//	INFO id size sum       size and hex encoded SHA-256 sum of whole file
+//	DATA id offset data    chunk of the file
+//	ACK id offset          data up to offset were written
+//	ERR id code message    request failed
+//	CANCEL id              transfer is cancelled by the receiver
+//
+// The sender has at most n chunks not acknowledged, n is set by Window
+// option of the receiver. Fetch keeps received data in a ".part" file, next
+// Fetch of the same file continues from its end.
+package filetransfer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZFILE/1"
+
+const (
+	kindOffer  = "OFFER"
+	kindGet    = "GET"
+	kindInfo   = "INFO"
+	kindData   = "DATA"
+	kindAck    = "ACK"
+	kindErr    = "ERR"
+	kindCancel = "CANCEL"
+)
+
+// error codes of ERR
+const (
+	codeNotFound = "NOTFOUND"
+	codeFailed   = "FAILED"
+)
+
+const (
+	// DefaultChunkSize is the size of data in one DATA message
+	DefaultChunkSize = 256 << 10
+
+	// DefaultWindow is the number of chunks sent without acknowledgement
+	DefaultWindow = 8
+
+	// maxWindow limits window requested by peers
+	maxWindow = 1024
+)
+
+var (
+	// ErrUnknownPeer is returned when fetching from peer which is not
+	// connected
+	ErrUnknownPeer = errors.New("filetransfer: unknown peer")
+
+	// ErrNotFound is returned when the peer does not share the file
+	ErrNotFound = errors.New("filetransfer: file not found")
+
+	// ErrPeerExit is returned when the peer exits during transfer
+	ErrPeerExit = errors.New("filetransfer: peer exited")
+
+	// ErrChecksum is returned when received file does not match its sum,
+	// partial data are removed
+	ErrChecksum = errors.New("filetransfer: checksum mismatch")
+
+	// ErrProtocol is returned for unexpected messages of the peer
+	ErrProtocol = errors.New("filetransfer: protocol error")
+)
+
+// Sender sends whispers to peers, it is implemented by *zyre.Node
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	PeerAddress(peer string) (string, bool)
+}
+
+// Offer is a file offered by peer
+type Offer struct {
+	Peer string
+	Name string
+	Size int64
+	Sum  string
+}
+
+// Progress reports the state of a fetch
+type Progress struct {
+	Peer        string
+	Name        string
+	Transferred int64
+	Size        int64
+}
+
+// Option configures Service
+type Option func(*Service)
+
+// ChunkSize sets the size of data in one message sent by the service
+func ChunkSize(size int) Option {
+	return func(s *Service) {
+		if size > 0 {
+			s.chunkSize = size
+		}
+	}
+}
+
+// Window sets the number of chunks a peer sends to Fetch without
+// acknowledgement
+func Window(n int) Option {
+	return func(s *Service) {
+		if n > 0 && n <= maxWindow {
+			s.window = n
+		}
+	}
+}
+
+// OnOffer sets the function called for offers of peers
+func OnOffer(fn func(Offer)) Option {
+	return func(s *Service) {
+		s.offers = fn
+	}
+}
+
+// OnProgress sets the function called after each chunk written by Fetch
+func OnProgress(fn func(Progress)) Option {
+	return func(s *Service) {
+		s.progress = fn
+	}
+}
+
+// Service shares files with peers and fetches files from them, it is safe
+// for concurrent use and runs any number of transfers at once
+type Service struct {
+	sender    Sender
+	chunkSize int
+	window    int
+	offers    func(Offer)
+	progress  func(Progress)
+
+	id uint64
+
+	mu       sync.Mutex
+	shared   map[string]string    // name to path
+	uploads  map[string]*upload   // by peer and id
+	fetches  map[string]*download // by id
+	closed   bool
+	uploadWg sync.WaitGroup
+}
+
+// New creates a service sending by sender (usually *zyre.Node)
+func New(sender Sender, options ...Option) *Service {
+	s := &Service{
+		sender:    sender,
+		chunkSize: DefaultChunkSize,
+		window:    DefaultWindow,
+		shared:    make(map[string]string),
+		uploads:   make(map[string]*upload),
+		fetches:   make(map[string]*download),
+	}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// Share makes the file at path available to peers under name
+func (s *Service) Share(name, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("Service.Share: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("Service.Share: %s is not a regular file", path)
+	}
+	s.mu.Lock()
+	s.shared[name] = path
+	s.mu.Unlock()
+	return nil
+}
+
+// Unshare stops sharing of name, running transfers are not affected
+func (s *Service) Unshare(name string) {
+	s.mu.Lock()
+	delete(s.shared, name)
+	s.mu.Unlock()
+}
+
+// Offer announces shared file name to peer, it is reported by OnOffer
+// function of the peer
+func (s *Service) Offer(peer, name string) error {
+	s.mu.Lock()
+	path, ok := s.shared[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	size, sum, err := checksum(path)
+	if err != nil {
+		return fmt.Errorf("Service.Offer: %w", err)
+	}
+	return s.sender.Whisper(peer, frames(kindOffer, name, strconv.FormatInt(size, 10), sum)...)
+}
+
+// Close cancels transfers sent by the service and waits for them
+func (s *Service) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, u := range s.uploads {
+		u.cancel()
+	}
+	s.mu.Unlock()
+	s.uploadWg.Wait()
+}
+
+// Dispatch handles file transfer messages. Returns true if the event was
+// consumed by the service, other events, including Exit, should be
+// processed by the application.
+func (s *Service) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		if len(m.Message) < 2 || string(m.Message[0]) != protocol {
+			return false
+		}
+		s.handle(m.Peer, string(m.Message[1]), m.Message[2:])
+		return true
+	case zyre.Exit:
+		s.exit(m.Peer)
+	case zyre.Stop:
+		s.exit("")
+	}
+	return false
+}
+
+func (s *Service) handle(peer, kind string, args [][]byte) {
+	switch kind {
+	case kindOffer:
+		if len(args) != 3 || s.offers == nil {
+			return
+		}
+		size, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return
+		}
+		s.offers(Offer{Peer: peer, Name: string(args[0]), Size: size, Sum: string(args[2])})
+	case kindGet:
+		if len(args) != 4 {
+			return
+		}
+		offset, err1 := strconv.ParseInt(string(args[2]), 10, 64)
+		window, err2 := strconv.Atoi(string(args[3]))
+		if err1 != nil || err2 != nil || offset < 0 || window < 1 || window > maxWindow {
+			s.sender.Whisper(peer, frames(kindErr, string(args[0]), codeFailed, "invalid request")...)
+			return
+		}
+		s.serve(peer, string(args[0]), string(args[1]), offset, window)
+	case kindAck, kindCancel:
+		if len(args) < 1 {
+			return
+		}
+		s.mu.Lock()
+		u, ok := s.uploads[peer+"/"+string(args[0])]
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+		if kind == kindCancel {
+			u.cancel()
+			return
+		}
+		if len(args) == 2 {
+			if offset, err := strconv.ParseInt(string(args[1]), 10, 64); err == nil {
+				u.ack(offset)
+			}
+		}
+	case kindInfo, kindData, kindErr:
+		if len(args) < 1 {
+			return
+		}
+		s.mu.Lock()
+		d, ok := s.fetches[string(args[0])]
+		s.mu.Unlock()
+		if ok && d.peer == peer {
+			d.deliver(message{kind: kind, args: args[1:]})
+		}
+	}
+}
+
+// exit cancels transfers of peer, or of all peers if peer is empty
+func (s *Service) exit(peer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.uploads {
+		if peer == "" || u.peer == peer {
+			u.cancel()
+		}
+	}
+	for _, d := range s.fetches {
+		if peer == "" || d.peer == peer {
+			d.exit()
+		}
+	}
+}
+
+func (s *Service) nextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&s.id, 1), 10)
+}
+
+func frames(kind string, args ...string) [][]byte {
+	f := make([][]byte, 0, len(args)+2)
+	f = append(f, []byte(protocol), []byte(kind))
+	for _, a := range args {
+		f = append(f, []byte(a))
+	}
+	return f
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package filetransfer
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromq/gozyre/internal/testpeer"
+)
+
+// peer is a node with file transfer service fed by its events
+type peer struct {
+	*testpeer.Peer
+	service *Service
+	offers  chan Offer
+}
+
+func newPeer(t *testing.T, name string, options ...Option) *peer {
+	p := &peer{
+		Peer:   testpeer.New(t, name, 5684),
+		offers: make(chan Offer, 16),
+	}
+	options = append([]Option{OnOffer(func(o Offer) { p.offers <- o })}, options...)
+	p.service = New(p.Node, options...)
+	p.Start(t, p.service.Dispatch)
+	return p
+}
+
+func (p *peer) close() {
+	p.service.Close()
+	p.Close()
+}
+
+// writeFile writes size random bytes to dir/name
+func writeFile(t *testing.T, dir, name string, size int) (string, []byte) {
+	data := make([]byte, size)
+	rand.Read(data)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFileTransfer(t *testing.T) {
+
+	assert := assert.New(t)
+
+	src, dst := t.TempDir(), t.TempDir()
+	server := newPeer(t, "server", ChunkSize(32<<10))
+	defer server.close()
+	client := newPeer(t, "client", Window(4))
+	defer client.close()
+	client.WaitEnter(t, server.Node.UUID())
+
+	logPath, logData := writeFile(t, src, "log", 1<<20+3)
+	fwPath, fwData := writeFile(t, src, "firmware", 300<<10)
+	emptyPath, _ := writeFile(t, src, "empty", 0)
+	assert.NoError(server.service.Share("log", logPath))
+	assert.NoError(server.service.Share("firmware", fwPath))
+	assert.NoError(server.service.Share("empty", emptyPath))
+	assert.Error(server.service.Share("missing", filepath.Join(src, "missing")))
+
+	assert.NoError(server.service.Offer(client.Node.UUID(), "firmware"))
+	select {
+	case o := <-client.offers:
+		assert.Equal(server.Node.UUID(), o.Peer)
+		assert.Equal("firmware", o.Name)
+		assert.Equal(int64(len(fwData)), o.Size)
+		assert.Len(o.Sum, 64)
+	case <-time.After(5 * time.Second):
+		t.Fatal("offer not received")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	uuid := server.Node.UUID()
+
+	// concurrent transfers
+	errs := make(chan error, 2)
+	go func() { errs <- client.service.Fetch(ctx, uuid, "log", filepath.Join(dst, "log")) }()
+	go func() { errs <- client.service.Fetch(ctx, uuid, "firmware", filepath.Join(dst, "firmware")) }()
+	assert.NoError(<-errs)
+	assert.NoError(<-errs)
+	assert.Equal(logData, readFile(t, filepath.Join(dst, "log")))
+	assert.Equal(fwData, readFile(t, filepath.Join(dst, "firmware")))
+	_, err := os.Stat(filepath.Join(dst, "log.part"))
+	assert.True(os.IsNotExist(err))
+
+	assert.NoError(client.service.Fetch(ctx, uuid, "empty", filepath.Join(dst, "empty")))
+	assert.Empty(readFile(t, filepath.Join(dst, "empty")))
+
+	assert.Equal(ErrNotFound, client.service.Fetch(ctx, uuid, "missing", filepath.Join(dst, "missing")))
+	assert.Equal(ErrUnknownPeer, client.service.Fetch(ctx, "NO-SUCH-PEER", "log", filepath.Join(dst, "x")))
+}
+
+func TestFileTransferResume(t *testing.T) {
+
+	assert := assert.New(t)
+
+	src, dst := t.TempDir(), t.TempDir()
+	server := newPeer(t, "server", ChunkSize(16<<10))
+	defer server.close()
+	var first int64 = -1
+	client := newPeer(t, "client", Window(1), OnProgress(func(p Progress) {
+		if first < 0 {
+			first = p.Transferred
+		}
+	}))
+	defer client.close()
+	client.WaitEnter(t, server.Node.UUID())
+
+	path, data := writeFile(t, src, "log", 256<<10)
+	assert.NoError(server.service.Share("log", path))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	uuid := server.Node.UUID()
+
+	// cancelled transfer keeps received data
+	out := filepath.Join(dst, "log")
+	cctx, ccancel := context.WithCancel(ctx)
+	client.service.progress = func(p Progress) {
+		if p.Transferred >= 64<<10 {
+			ccancel()
+		}
+	}
+	assert.Equal(context.Canceled, client.service.Fetch(cctx, uuid, "log", out))
+	part := readFile(t, out+".part")
+	assert.True(len(part) >= 64<<10 && len(part) < len(data), "%d", len(part))
+	assert.Equal(data[:len(part)], part)
+
+	// and continues from there
+	client.service.progress = func(p Progress) {
+		if first < 0 {
+			first = p.Transferred
+		}
+	}
+	assert.NoError(client.service.Fetch(ctx, uuid, "log", out))
+	assert.Equal(int64(len(part)+16<<10), first)
+	assert.Equal(data, readFile(t, out))
+
+	// corrupted part fails the checksum and is removed
+	os.Remove(out)
+	corrupt := append([]byte{}, data[:100<<10]...)
+	corrupt[0] ^= 0xff
+	assert.NoError(os.WriteFile(out+".part", corrupt, 0644))
+	assert.Equal(ErrChecksum, client.service.Fetch(ctx, uuid, "log", out))
+	_, err := os.Stat(out + ".part")
+	assert.True(os.IsNotExist(err))
+	assert.NoError(client.service.Fetch(ctx, uuid, "log", out))
+	assert.Equal(data, readFile(t, out))
+
+	// sender is not left with cancelled uploads
+	time.Sleep(100 * time.Millisecond)
+	server.service.mu.Lock()
+	assert.Empty(server.service.uploads)
+	server.service.mu.Unlock()
+}
+
+func TestFileTransferPeerExit(t *testing.T) {
+
+	assert := assert.New(t)
+
+	src, dst := t.TempDir(), t.TempDir()
+	server := newPeer(t, "server", ChunkSize(16<<10))
+	closed := make(chan struct{})
+	client := newPeer(t, "client", Window(1), OnProgress(func(p Progress) {
+		select {
+		case <-closed:
+		default:
+			close(closed)
+			go server.close()
+		}
+	}))
+	defer client.close()
+	client.WaitEnter(t, server.Node.UUID())
+
+	path, _ := writeFile(t, src, "log", 1<<20)
+	assert.NoError(server.service.Share("log", path))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	out := filepath.Join(dst, "log")
+	assert.Equal(ErrPeerExit, client.service.Fetch(ctx, server.Node.UUID(), "log", out))
+	_, err := os.Stat(out + ".part")
+	assert.NoError(err)
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package filetransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// upload is a file sent to peer
+type upload struct {
+	peer   string
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	acked int64
+	wake  chan struct{}
+}
+
+func (u *upload) ack(offset int64) {
+	u.mu.Lock()
+	if offset > u.acked {
+		u.acked = offset
+	}
+	u.mu.Unlock()
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (u *upload) pending(offset int64) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return offset - u.acked
+}
+
+// serve starts sending of shared file name to peer
+func (s *Service) serve(peer, id, name string, offset int64, window int) {
+	s.mu.Lock()
+	path, ok := s.shared[name]
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if !ok {
+		s.mu.Unlock()
+		s.sender.Whisper(peer, frames(kindErr, id, codeNotFound, name)...)
+		return
+	}
+	key := peer + "/" + id
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &upload{
+		peer:   peer,
+		cancel: cancel,
+		acked:  offset,
+		wake:   make(chan struct{}, 1),
+	}
+	s.uploads[key] = u
+	s.uploadWg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.uploadWg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.uploads, key)
+			s.mu.Unlock()
+			cancel()
+		}()
+		err := s.upload(ctx, u, id, path, offset, window)
+		if err != nil && ctx.Err() == nil {
+			s.sender.Whisper(peer, frames(kindErr, id, codeFailed, err.Error())...)
+		}
+	}()
+}
+
+func (s *Service) upload(ctx context.Context, u *upload, id, path string, offset int64, window int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, sum, err := checksumReader(f)
+	if err != nil {
+		return err
+	}
+	err = s.sender.Whisper(u.peer, frames(kindInfo, id, strconv.FormatInt(size, 10), sum)...)
+	if err != nil {
+		return err
+	}
+
+	limit := int64(window) * int64(s.chunkSize)
+	buf := make([]byte, s.chunkSize)
+	for offset < size {
+		for u.pending(offset) >= limit {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-u.wake:
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		n, err := f.ReadAt(buf, offset)
+		if n == 0 {
+			if err == io.EOF {
+				return fmt.Errorf("%s was truncated", path)
+			}
+			return err
+		}
+		data := frames(kindData, id, strconv.FormatInt(offset, 10))
+		if err := s.sender.Whisper(u.peer, append(data, buf[:n])...); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+	return nil
+}
+
+// checksum returns size and hex encoded SHA-256 sum of file
+func checksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	return checksumReader(f)
+}
+
+func checksumReader(r io.Reader) (int64, string, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,615 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package fragment sends large payloads split to bounded fragments and
+// reassembles them on receipt. Payload is checked by SHA-256 sum, partial
+// transfers are dropped when sending peer exits. Payload can be read from
+// io.Reader and large received payloads are written to temporary files, so
+// neither side has to hold the whole payload in memory.
+//
+// All messages start with frame "ZFRAG/1" and a kind:
+//
+//	DATA id offset total sum data   fragment, sum is in the last one only
+//	ACK id size                     receiver has size bytes of transfer id
+//	CANCEL id                       receiver dropped transfer id
+//	ABORT id                        sender cancelled transfer id
+//
+// DATA is a whisper or shout, other messages are whispers. Sum is hex
+// encoded SHA-256 sum of the payload. The sender has at most Window
+// fragments not acknowledged by any receiving peer.
+package fragment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZFRAG/1"
+
+const (
+	kindData   = "DATA"
+	kindAck    = "ACK"
+	kindCancel = "CANCEL"
+	kindAbort  = "ABORT"
+)
+
+const (
+	// DefaultFragmentSize is the maximum size of data in one fragment
+	DefaultFragmentSize = 1 << 20
+
+	// DefaultWindow is the number of fragments sent without
+	// acknowledgement
+	DefaultWindow = 8
+
+	// DefaultMaxSize is the maximum size of received payload
+	DefaultMaxSize = 4 << 30
+
+	// DefaultSpoolSize is the size above which received payloads are
+	// written to temporary files
+	DefaultSpoolSize = 16 << 20
+
+	// DefaultMaxPending is the maximum size of data kept in memory by
+	// incomplete transfers of one peer
+	DefaultMaxPending = 128 << 20
+)
+
+var (
+	// ErrChecksum is reported when reassembled payload does not match its
+	// sum
+	ErrChecksum = errors.New("fragment: checksum mismatch")
+
+	// ErrTooLarge is reported when received payload exceeds maximum size or
+	// incomplete transfers of the peer exceed maximum pending size
+	ErrTooLarge = errors.New("fragment: payload too large")
+
+	// ErrIncomplete is reported for partial transfers dropped because
+	// the peer exited, aborted the transfer or sent an unexpected fragment
+	ErrIncomplete = errors.New("fragment: incomplete transfer")
+
+	// ErrCancelled is returned by Whisper when the receiving peer drops
+	// the transfer
+	ErrCancelled = errors.New("fragment: transfer cancelled by peer")
+
+	// ErrPeerExit is returned by Whisper when the receiving peer exits
+	// during transfer
+	ErrPeerExit = errors.New("fragment: peer exited")
+)
+
+// Sender sends whispers and shouts, it is implemented by *zyre.Node. Frames
+// are reused when Whisper or Shout returns.
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	Shout(group string, data ...[]byte) error
+	PeersByGroup(group string) []string
+}
+
+// Message is a reassembled payload
+type Message struct {
+	Peer    string
+	Name    string
+	Group   string // empty for payloads sent by Whisper
+	Payload []byte // nil for payloads written to File
+	// File is the path of temporary file with payload larger than spool
+	// size, handler owns the file and should remove it
+	File string
+}
+
+// Handler receives reassembled payloads
+type Handler func(Message)
+
+// Progress reports the state of a transfer
+type Progress struct {
+	Incoming    bool
+	Peer        string // sending peer for incoming, target peer or group for outgoing
+	ID          string
+	Transferred int64
+	Total       int64
+}
+
+// Option configures Fragmenter
+type Option func(*Fragmenter)
+
+// FragmentSize sets the maximum size of data in one fragment
+func FragmentSize(size int) Option {
+	return func(f *Fragmenter) {
+		if size > 0 {
+			f.fragmentSize = size
+		}
+	}
+}
+
+// Window sets the number of fragments sent without acknowledgement of
+// receiving peers
+func Window(n int) Option {
+	return func(f *Fragmenter) {
+		if n > 0 {
+			f.window = n
+		}
+	}
+}
+
+// MaxSize sets the maximum size of received payload
+func MaxSize(size int64) Option {
+	return func(f *Fragmenter) {
+		if size > 0 {
+			f.maxSize = size
+		}
+	}
+}
+
+// MaxPending sets the maximum size of data kept in memory by incomplete
+// transfers of one peer, buffers of transfers grow as fragments arrive
+func MaxPending(size int) Option {
+	return func(f *Fragmenter) {
+		if size > 0 {
+			f.maxPending = size
+		}
+	}
+}
+
+// Spool sets where received payloads larger than size are written, they are
+// kept in temporary files in dir instead of memory. Empty dir is the default
+// directory for temporary files.
+func Spool(dir string, size int64) Option {
+	return func(f *Fragmenter) {
+		f.spoolDir = dir
+		if size > 0 {
+			f.spoolSize = size
+		}
+	}
+}
+
+// OnProgress sets the function called after each sent or received fragment
+func OnProgress(fn func(Progress)) Option {
+	return func(f *Fragmenter) {
+		f.progress = fn
+	}
+}
+
+// OnError sets the function called when incoming transfer from peer fails
+func OnError(fn func(peer, id string, err error)) Option {
+	return func(f *Fragmenter) {
+		f.errors = fn
+	}
+}
+
+// Fragmenter sends and reassembles fragmented payloads, it is safe for
+// concurrent use
+type Fragmenter struct {
+	sender       Sender
+	handler      Handler
+	fragmentSize int
+	window       int
+	maxSize      int64
+	maxPending   int
+	spoolDir     string
+	spoolSize    int64
+	progress     func(Progress)
+	errors       func(peer, id string, err error)
+
+	id uint64
+
+	mu       sync.Mutex
+	partial  map[string]*partial  // by peer and id
+	pending  map[string]int       // received bytes of partial in memory by peer
+	outgoing map[string]*outgoing // by id
+}
+
+// partial is an incoming transfer
+type partial struct {
+	peer  string
+	id    string
+	total int64
+	n     int64
+	hash  hash.Hash
+	buf   []byte
+	file  *os.File
+}
+
+// write appends data to the payload
+func (p *partial) write(data []byte) error {
+	p.hash.Write(data)
+	if p.file == nil {
+		p.buf = append(p.buf, data...)
+		return nil
+	}
+	_, err := p.file.Write(data)
+	return err
+}
+
+// outgoing is a sent transfer, acked are sizes acknowledged by receiving
+// peers
+type outgoing struct {
+	whisper bool
+	acked   map[string]int64
+	err     error
+	wake    chan struct{}
+}
+
+func (o *outgoing) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// New creates a fragmenter sending by sender (usually *zyre.Node) and
+// passing reassembled payloads to handler
+func New(sender Sender, handler Handler, options ...Option) *Fragmenter {
+	f := &Fragmenter{
+		sender:       sender,
+		handler:      handler,
+		fragmentSize: DefaultFragmentSize,
+		window:       DefaultWindow,
+		maxSize:      DefaultMaxSize,
+		maxPending:   DefaultMaxPending,
+		spoolSize:    DefaultSpoolSize,
+		partial:      make(map[string]*partial),
+		pending:      make(map[string]int),
+		outgoing:     make(map[string]*outgoing),
+	}
+	for _, o := range options {
+		o(f)
+	}
+	return f
+}
+
+// Whisper sends payload to peer in fragments, it returns when the last
+// fragment is queued or ctx is done. It fails with ErrCancelled or
+// ErrPeerExit when the peer drops the transfer or exits.
+func (f *Fragmenter) Whisper(ctx context.Context, peer string, payload []byte) error {
+	return f.WhisperReader(ctx, peer, bytes.NewReader(payload), int64(len(payload)))
+}
+
+// WhisperReader sends size bytes read from r to peer like Whisper
+func (f *Fragmenter) WhisperReader(ctx context.Context, peer string, r io.Reader, size int64) error {
+	return f.send(ctx, peer, []string{peer}, true, r, size, func(data ...[]byte) error {
+		return f.sender.Whisper(peer, data...)
+	})
+}
+
+// Shout sends payload to group in fragments, it returns when the last
+// fragment is queued or ctx is done. Transfer is paced by peers which are
+// members of group when Shout starts, members which drop the transfer or
+// exit are not waited for. Peers joining later ignore the transfer.
+func (f *Fragmenter) Shout(ctx context.Context, group string, payload []byte) error {
+	return f.ShoutReader(ctx, group, bytes.NewReader(payload), int64(len(payload)))
+}
+
+// ShoutReader sends size bytes read from r to group like Shout
+func (f *Fragmenter) ShoutReader(ctx context.Context, group string, r io.Reader, size int64) error {
+	return f.send(ctx, group, f.sender.PeersByGroup(group), false, r, size, func(data ...[]byte) error {
+		return f.sender.Shout(group, data...)
+	})
+}
+
+func (f *Fragmenter) send(ctx context.Context, target string, peers []string, whisper bool, r io.Reader, size int64, send func(...[]byte) error) error {
+	if size < 0 {
+		return fmt.Errorf("fragment: invalid size %d", size)
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&f.id, 1), 10)
+	o := &outgoing{
+		whisper: whisper,
+		acked:   make(map[string]int64, len(peers)),
+		wake:    make(chan struct{}, 1),
+	}
+	for _, peer := range peers {
+		o.acked[peer] = 0
+	}
+	f.mu.Lock()
+	f.outgoing[id] = o
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.outgoing, id)
+		f.mu.Unlock()
+	}()
+
+	h := sha256.New()
+	total := []byte(strconv.FormatInt(size, 10))
+	buf := make([]byte, f.fragmentSize)
+	for offset := int64(0); ; {
+		if err := f.wait(ctx, o, offset); err != nil {
+			if offset > 0 {
+				send([]byte(protocol), []byte(kindAbort), []byte(id))
+			}
+			return err
+		}
+		n := size - offset
+		if n > int64(len(buf)) {
+			n = int64(len(buf))
+		}
+		data := buf[:n]
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if offset > 0 {
+				send([]byte(protocol), []byte(kindAbort), []byte(id))
+			}
+			return fmt.Errorf("fragment: %w", err)
+		}
+		h.Write(data)
+		var sum []byte
+		if offset+n == size {
+			sum = []byte(hex.EncodeToString(h.Sum(nil)))
+		}
+		err := send(
+			[]byte(protocol), []byte(kindData), []byte(id),
+			[]byte(strconv.FormatInt(offset, 10)), total, sum, data)
+		if err != nil {
+			return err
+		}
+		offset += n
+		if f.progress != nil {
+			f.progress(Progress{Peer: target, ID: id, Transferred: offset, Total: size})
+		}
+		if offset == size {
+			return nil
+		}
+	}
+}
+
+// wait waits until fragment at offset fits to the window of every
+// receiving peer
+func (f *Fragmenter) wait(ctx context.Context, o *outgoing, offset int64) error {
+	limit := int64(f.window) * int64(f.fragmentSize)
+	for {
+		f.mu.Lock()
+		err := o.err
+		ready := true
+		for _, acked := range o.acked {
+			if offset-acked >= limit {
+				ready = false
+				break
+			}
+		}
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if ready {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.wake:
+		}
+	}
+}
+
+// Dispatch reassembles fragments, paces sent transfers and drops partial
+// transfers of peers which exited. Returns true if the event was consumed
+// by the fragmenter, other events, including Exit, should be processed by
+// the application.
+func (f *Fragmenter) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		return f.receive(m.Peer, m.Name, "", m.Message)
+	case zyre.Shout:
+		return f.receive(m.Peer, m.Name, m.Group, m.Message)
+	case zyre.Exit:
+		f.drop(m.Peer)
+	case zyre.Stop:
+		f.drop("")
+	}
+	return false
+}
+
+func (f *Fragmenter) receive(peer, name, group string, frames [][]byte) bool {
+	if len(frames) < 3 || string(frames[0]) != protocol {
+		return false
+	}
+	id := string(frames[2])
+	key := peer + "/" + id
+	switch string(frames[1]) {
+	case kindAbort:
+		f.mu.Lock()
+		p, ok := f.partial[key]
+		if ok {
+			f.remove(key, p)
+		}
+		f.mu.Unlock()
+		if ok {
+			f.fail(p, ErrIncomplete)
+		}
+		return true
+	case kindAck:
+		if len(frames) != 4 {
+			return true
+		}
+		if n, err := strconv.ParseInt(string(frames[3]), 10, 64); err == nil {
+			f.ack(peer, id, n)
+		}
+		return true
+	case kindCancel:
+		f.cancel(peer, id, ErrCancelled)
+		return true
+	case kindData:
+	default:
+		return true
+	}
+	if len(frames) != 7 {
+		return true
+	}
+	offset, err1 := strconv.ParseInt(string(frames[3]), 10, 64)
+	total, err2 := strconv.ParseInt(string(frames[4]), 10, 64)
+	sum := string(frames[5])
+	data := frames[6]
+	if err1 != nil || err2 != nil || total < 0 {
+		return true
+	}
+
+	f.mu.Lock()
+	p, ok := f.partial[key]
+	var err error
+	switch {
+	case !ok && offset != 0:
+		// beginning of the transfer was lost, rest is ignored
+		f.mu.Unlock()
+		return true
+	case !ok && total > f.maxSize:
+		p = &partial{peer: peer, id: id}
+		err = ErrTooLarge
+	case !ok:
+		p = &partial{peer: peer, id: id, total: total, hash: sha256.New()}
+		if total > f.spoolSize {
+			p.file, err = os.CreateTemp(f.spoolDir, "fragment-")
+		}
+		if err == nil {
+			f.partial[key] = p
+		}
+	}
+	// only payload of the last fragment can be empty, only the last one
+	// has sum
+	last := offset+int64(len(data)) == total
+	if err == nil && (offset != p.n || total != p.total || int64(len(data)) > total-offset ||
+		(len(data) == 0 && total > 0) || last != (sum != "")) {
+		err = ErrIncomplete
+	}
+	if err == nil && p.file == nil && f.pending[peer]+len(data) > f.maxPending {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		err = p.write(data)
+	}
+	if err != nil {
+		f.remove(key, p)
+		f.mu.Unlock()
+		f.sender.Whisper(peer, []byte(protocol), []byte(kindCancel), []byte(id))
+		f.fail(p, err)
+		return true
+	}
+	if p.file == nil {
+		f.pending[peer] += len(data)
+	}
+	p.n += int64(len(data))
+	n := p.n
+	if last {
+		f.remove(key, p)
+	}
+	f.mu.Unlock()
+
+	f.sender.Whisper(peer, []byte(protocol), []byte(kindAck), []byte(id), []byte(strconv.FormatInt(n, 10)))
+	if f.progress != nil {
+		f.progress(Progress{Incoming: true, Peer: peer, ID: id, Transferred: n, Total: total})
+	}
+	if !last {
+		return true
+	}
+	if hex.EncodeToString(p.hash.Sum(nil)) != sum {
+		f.fail(p, ErrChecksum)
+		return true
+	}
+	m := Message{Peer: peer, Name: name, Group: group, Payload: p.buf}
+	if p.file != nil {
+		if err := p.file.Close(); err != nil {
+			f.fail(p, err)
+			return true
+		}
+		m.File = p.file.Name()
+	}
+	if f.handler != nil {
+		f.handler(m)
+	}
+	return true
+}
+
+// ack records size of transfer id acknowledged by peer
+func (f *Fragmenter) ack(peer, id string, n int64) {
+	f.mu.Lock()
+	o, ok := f.outgoing[id]
+	if ok {
+		if acked, found := o.acked[peer]; found && n > acked {
+			o.acked[peer] = n
+		}
+	}
+	f.mu.Unlock()
+	if ok {
+		o.notify()
+	}
+}
+
+// cancel stops waiting for peer in transfer id, or in all transfers if id
+// is empty, whisper fails with err. Empty peer matches all peers.
+func (f *Fragmenter) cancel(peer, id string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for oid, o := range f.outgoing {
+		if id != "" && oid != id {
+			continue
+		}
+		for p := range o.acked {
+			if peer != "" && p != peer {
+				continue
+			}
+			delete(o.acked, p)
+			if o.whisper {
+				o.err = err
+			}
+			o.notify()
+		}
+	}
+}
+
+// drop fails partial transfers of peer, or of all peers if peer is empty,
+// and stops sending to it
+func (f *Fragmenter) drop(peer string) {
+	f.cancel(peer, "", ErrPeerExit)
+	var dropped []*partial
+	f.mu.Lock()
+	for key, p := range f.partial {
+		if peer == "" || p.peer == peer {
+			dropped = append(dropped, p)
+			f.remove(key, p)
+		}
+	}
+	f.mu.Unlock()
+	for _, p := range dropped {
+		f.fail(p, ErrIncomplete)
+	}
+}
+
+// remove removes partial transfer, caller must hold the lock
+func (f *Fragmenter) remove(key string, p *partial) {
+	if f.partial[key] != p {
+		return
+	}
+	delete(f.partial, key)
+	f.pending[p.peer] -= len(p.buf)
+	if f.pending[p.peer] <= 0 {
+		delete(f.pending, p.peer)
+	}
+}
+
+// Pending returns the number of incomplete incoming transfers
+func (f *Fragmenter) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.partial)
+}
+
+// fail removes temporary file of failed transfer and reports err
+func (f *Fragmenter) fail(p *partial, err error) {
+	if p.file != nil {
+		p.file.Close()
+		os.Remove(p.file.Name())
+	}
+	if f.errors != nil {
+		f.errors(p.peer, p.id, err)
+	}
+}
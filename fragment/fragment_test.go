@@ -0,0 +1,426 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package fragment
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+)
+
+// recorder keeps sent messages as events of peer "PEER", the only member
+// of groups
+type recorder struct {
+	mu     sync.Mutex
+	events []zyre.Event
+}
+
+func (r *recorder) Whisper(peer string, data ...[]byte) error {
+	r.mu.Lock()
+	r.events = append(r.events, zyre.Whisper{Peer: "PEER", Name: "peer", Message: copyFrames(data)})
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) Shout(group string, data ...[]byte) error {
+	r.mu.Lock()
+	r.events = append(r.events, zyre.Shout{Peer: "PEER", Name: "peer", Group: group, Message: copyFrames(data)})
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) PeersByGroup(group string) []string {
+	return []string{"PEER"}
+}
+
+func (r *recorder) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+// kinds returns kinds of recorded messages
+func (r *recorder) kinds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kinds []string
+	for _, e := range r.events {
+		kinds = append(kinds, string(e.(zyre.Whisper).Message[1]))
+	}
+	return kinds
+}
+
+// loopback passes messages to the fragmenter of the other side as events
+// of peer "PEER"
+type loopback struct {
+	to *Fragmenter
+}
+
+func (l *loopback) Whisper(peer string, data ...[]byte) error {
+	l.to.Dispatch(zyre.Whisper{Peer: "PEER", Name: "peer", Message: copyFrames(data)})
+	return nil
+}
+
+func (l *loopback) Shout(group string, data ...[]byte) error {
+	l.to.Dispatch(zyre.Shout{Peer: "PEER", Name: "peer", Group: group, Message: copyFrames(data)})
+	return nil
+}
+
+func (l *loopback) PeersByGroup(group string) []string {
+	return []string{"PEER"}
+}
+
+func copyFrames(data [][]byte) [][]byte {
+	c := make([][]byte, len(data))
+	for i, d := range data {
+		c[i] = append([]byte{}, d...)
+	}
+	return c
+}
+
+type failure struct {
+	peer string
+	err  error
+}
+
+// newReceiver returns fragmenter collecting messages and errors, its
+// acknowledgements are kept by recorder
+func newReceiver(options ...Option) (*Fragmenter, *[]Message, *[]failure) {
+	var messages []Message
+	var failures []failure
+	options = append(options, OnError(func(peer, id string, err error) {
+		failures = append(failures, failure{peer, err})
+	}))
+	f := New(&recorder{}, func(m Message) {
+		messages = append(messages, m)
+	}, options...)
+	return f, &messages, &failures
+}
+
+func payload(size int) []byte {
+	b := make([]byte, size)
+	rand.Read(b)
+	return b
+}
+
+func TestFragment(t *testing.T) {
+
+	assert := assert.New(t)
+
+	var sent []Progress
+	rec := &recorder{}
+	sender := New(rec, nil, FragmentSize(1000), OnProgress(func(p Progress) {
+		sent = append(sent, p)
+	}))
+	data := payload(4500)
+	assert.NoError(sender.Whisper(context.Background(), "PEER", data))
+	assert.NoError(sender.Shout(context.Background(), "GROUP", nil))
+	assert.Len(rec.events, 6)
+	assert.Equal(Progress{Peer: "PEER", ID: "1", Transferred: 4500, Total: 4500}, sent[4])
+
+	var received []int64
+	receiver, messages, failures := newReceiver(OnProgress(func(p Progress) {
+		assert.True(p.Incoming)
+		received = append(received, p.Transferred)
+	}))
+	for i, e := range rec.events {
+		assert.True(receiver.Dispatch(e))
+		if i < 4 {
+			assert.Equal(1, receiver.Pending())
+		}
+	}
+	assert.Equal([]int64{1000, 2000, 3000, 4000, 4500, 0}, received)
+	assert.Equal([]string{"ACK", "ACK", "ACK", "ACK", "ACK", "ACK"}, receiver.sender.(*recorder).kinds())
+	assert.Empty(*failures)
+	assert.Len(*messages, 2)
+	assert.Equal(Message{Peer: "PEER", Name: "peer", Payload: data}, (*messages)[0])
+	assert.Equal("GROUP", (*messages)[1].Group)
+	assert.Empty((*messages)[1].Payload)
+	assert.Equal(0, receiver.Pending())
+
+	// other messages are not consumed
+	assert.False(receiver.Dispatch(zyre.Whisper{Peer: "PEER", Message: [][]byte{[]byte("hello")}}))
+}
+
+func TestFragmentFailures(t *testing.T) {
+
+	assert := assert.New(t)
+
+	rec := &recorder{}
+	sender := New(rec, nil, FragmentSize(100), Window(100))
+	sender.Whisper(context.Background(), "PEER", payload(1000))
+	fragments := rec.events
+
+	// sending peer exits in the middle of transfer
+	receiver, messages, failures := newReceiver()
+	for _, e := range fragments[:5] {
+		receiver.Dispatch(e)
+	}
+	assert.Equal(1, receiver.Pending())
+	assert.False(receiver.Dispatch(zyre.Exit{Peer: "PEER", Name: "peer"}))
+	assert.Equal(0, receiver.Pending())
+	assert.Equal([]failure{{"PEER", ErrIncomplete}}, *failures)
+	assert.Empty(*messages)
+
+	// corrupted fragment
+	receiver, messages, failures = newReceiver()
+	for i, e := range fragments {
+		if i == 3 {
+			w := e.(zyre.Whisper)
+			data := append([]byte{}, w.Message[6]...)
+			data[0] ^= 0xff
+			w.Message = append(append([][]byte{}, w.Message[:6]...), data)
+			e = w
+		}
+		receiver.Dispatch(e)
+	}
+	assert.Equal([]failure{{"PEER", ErrChecksum}}, *failures)
+	assert.Empty(*messages)
+
+	// lost fragment
+	receiver, messages, failures = newReceiver()
+	for i, e := range fragments {
+		if i != 3 {
+			receiver.Dispatch(e)
+		}
+	}
+	assert.Equal([]failure{{"PEER", ErrIncomplete}}, *failures)
+	assert.Empty(*messages)
+	assert.Equal(0, receiver.Pending())
+	assert.Equal([]string{"ACK", "ACK", "ACK", "CANCEL"}, receiver.sender.(*recorder).kinds())
+
+	// payload above limit is not allocated, sender is told to stop
+	receiver, messages, failures = newReceiver(MaxSize(500))
+	for _, e := range fragments {
+		receiver.Dispatch(e)
+	}
+	assert.Equal([]failure{{"PEER", ErrTooLarge}}, *failures)
+	assert.Empty(*messages)
+	assert.Equal(0, receiver.Pending())
+	assert.Equal([]string{"CANCEL"}, receiver.sender.(*recorder).kinds())
+
+	// concurrent transfers of a peer are limited by received data, buffers
+	// grow with fragments
+	rec = &recorder{}
+	sender = New(rec, nil, FragmentSize(100), Window(100))
+	sender.Whisper(context.Background(), "PEER", payload(1000))
+	sender.Whisper(context.Background(), "PEER", payload(1000))
+	receiver, messages, failures = newReceiver(MaxPending(1200))
+	for _, e := range rec.events[:5] {
+		receiver.Dispatch(e)
+	}
+	assert.True(cap(receiver.partial["PEER/1"].buf) < 1000)
+	assert.Equal(500, receiver.pending["PEER"])
+	for _, e := range rec.events[10:] {
+		receiver.Dispatch(e)
+	}
+	assert.Equal([]failure{{"PEER", ErrTooLarge}}, *failures)
+	assert.Equal(1, receiver.Pending())
+	assert.Equal(500, receiver.pending["PEER"])
+	receiver.Dispatch(zyre.Exit{Peer: "PEER", Name: "peer"})
+	assert.Empty(receiver.pending)
+	assert.Empty(*messages)
+
+	// cancelled transfer is aborted
+	rec = &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	sender = New(rec, nil, FragmentSize(100), Window(100), OnProgress(func(p Progress) {
+		if p.Transferred == 300 {
+			cancel()
+		}
+	}))
+	assert.Equal(context.Canceled, sender.Whisper(ctx, "PEER", payload(1000)))
+	assert.Len(rec.events, 4)
+	receiver, messages, failures = newReceiver()
+	for _, e := range rec.events {
+		receiver.Dispatch(e)
+	}
+	assert.Equal([]failure{{"PEER", ErrIncomplete}}, *failures)
+	assert.Equal(0, receiver.Pending())
+}
+
+// waitLen waits until rec has n messages
+func waitLen(t *testing.T, rec *recorder, n int) {
+	for i := 0; rec.len() != n; i++ {
+		if i == 100 {
+			t.Fatalf("%d messages sent, want %d", rec.len(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFragmentWindow(t *testing.T) {
+
+	assert := assert.New(t)
+
+	ack := func(peer, id, n string) zyre.Event {
+		return zyre.Whisper{Peer: peer, Message: [][]byte{[]byte(protocol), []byte(kindAck), []byte(id), []byte(n)}}
+	}
+	start := func(send func(*Fragmenter) error) (*Fragmenter, *recorder, chan error) {
+		rec := &recorder{}
+		f := New(rec, nil, FragmentSize(100), Window(2))
+		done := make(chan error, 1)
+		go func() { done <- send(f) }()
+		waitLen(t, rec, 2)
+		return f, rec, done
+	}
+	whisper := func(f *Fragmenter) error {
+		return f.Whisper(context.Background(), "PEER", payload(1000))
+	}
+
+	// sender waits for acknowledgements of the receiving peer
+	sender, rec, done := start(whisper)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(2, rec.len())
+	assert.True(sender.Dispatch(ack("OTHER", "1", "200")))
+	assert.True(sender.Dispatch(ack("PEER", "2", "200")))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(2, rec.len())
+	sender.Dispatch(ack("PEER", "1", "100"))
+	waitLen(t, rec, 3)
+	sender.Dispatch(ack("PEER", "1", "1000"))
+	assert.NoError(<-done)
+	assert.Equal(10, rec.len())
+
+	// receiver drops the transfer
+	sender, rec, done = start(whisper)
+	sender.Dispatch(zyre.Whisper{Peer: "PEER", Message: [][]byte{[]byte(protocol), []byte(kindCancel), []byte("1")}})
+	assert.Equal(ErrCancelled, <-done)
+	assert.Equal([]string{"DATA", "DATA", "ABORT"}, rec.kinds())
+
+	// receiver exits
+	sender, _, done = start(whisper)
+	assert.False(sender.Dispatch(zyre.Exit{Peer: "PEER"}))
+	assert.Equal(ErrPeerExit, <-done)
+
+	// sender is cancelled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	_, rec, done = start(func(f *Fragmenter) error {
+		return f.Whisper(ctx, "PEER", payload(1000))
+	})
+	cancel()
+	assert.Equal(context.Canceled, <-done)
+	assert.Equal([]string{"DATA", "DATA", "ABORT"}, rec.kinds())
+
+	// shout does not wait for members which exit
+	sender, rec, done = start(func(f *Fragmenter) error {
+		return f.Shout(context.Background(), "GROUP", payload(1000))
+	})
+	sender.Dispatch(zyre.Exit{Peer: "PEER"})
+	assert.NoError(<-done)
+	assert.Equal(10, rec.len())
+}
+
+func TestFragmentStream(t *testing.T) {
+
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	receiver, messages, failures := newReceiver(Spool(dir, 1000))
+	sender := New(&loopback{to: receiver}, nil, FragmentSize(100), Window(2))
+	receiver.sender = &loopback{to: sender}
+
+	// large payload is read from reader and written to file
+	data := payload(5000)
+	assert.NoError(sender.WhisperReader(context.Background(), "PEER", bytes.NewReader(data), int64(len(data))))
+	assert.NoError(sender.ShoutReader(context.Background(), "GROUP", bytes.NewReader(data[:1000]), 1000))
+	assert.Empty(*failures)
+	if !assert.Len(*messages, 2) {
+		return
+	}
+	m := (*messages)[0]
+	assert.Nil(m.Payload)
+	received, err := os.ReadFile(m.File)
+	assert.NoError(err)
+	assert.Equal(data, received)
+	os.Remove(m.File)
+	assert.Equal("GROUP", (*messages)[1].Group)
+	assert.Equal(data[:1000], (*messages)[1].Payload)
+	assert.Empty((*messages)[1].File)
+
+	// short reader aborts the transfer, temporary file is removed
+	err = sender.WhisperReader(context.Background(), "PEER", bytes.NewReader(data[:1500]), 2000)
+	assert.True(errors.Is(err, io.ErrUnexpectedEOF), err)
+	assert.Equal([]failure{{"PEER", ErrIncomplete}}, *failures)
+	files, err := os.ReadDir(dir)
+	assert.NoError(err)
+	assert.Empty(files)
+
+	assert.Error(sender.WhisperReader(context.Background(), "PEER", bytes.NewReader(nil), -1))
+}
+
+func TestFragmentNodes(t *testing.T) {
+
+	assert := assert.New(t)
+
+	newNode := func(name string) (*zyre.Node, <-chan zyre.Event, context.CancelFunc) {
+		node, err := zyre.New(name, zyre.SetPort(5683))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		events, _ := node.Events(ctx)
+		if err := node.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return node, events, cancel
+	}
+	sender, senderEvents, cancel := newNode("sender")
+	defer sender.Destroy()
+	defer cancel()
+	receiver, events, cancel := newNode("receiver")
+	defer receiver.Destroy()
+	defer cancel()
+	// sender receives acknowledgements
+	out := New(sender, nil, FragmentSize(64<<10))
+	go func() {
+		for e := range senderEvents {
+			out.Dispatch(e)
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for uuid := ""; uuid != sender.UUID(); {
+		select {
+		case e := <-events:
+			uuid = e.PeerID()
+		case <-timeout:
+			t.Fatal("ENTER not received")
+		}
+	}
+
+	messages := make(chan Message, 1)
+	f := New(receiver, func(m Message) { messages <- m }, Spool(t.TempDir(), 1<<20))
+	go func() {
+		for e := range events {
+			f.Dispatch(e)
+		}
+	}()
+
+	data := payload(4<<20 + 17)
+	assert.NoError(out.WhisperReader(context.Background(), receiver.UUID(), bytes.NewReader(data), int64(len(data))))
+	select {
+	case m := <-messages:
+		assert.Equal(sender.UUID(), m.Peer)
+		assert.Equal("sender", m.Name)
+		received, err := os.ReadFile(m.File)
+		assert.NoError(err)
+		assert.Equal(data, received)
+		os.Remove(m.File)
+	case <-time.After(10 * time.Second):
+		t.Fatal("payload not received")
+	}
+	sender.Stop()
+	receiver.Stop()
+}
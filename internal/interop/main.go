@@ -0,0 +1,62 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Command interop is the remote peer of interoperability test of backends,
+// the test runs it built with the other backend. It prints its UUID, joins
+// group INTEROP, sends whispers and shouts back and exits when stdin is
+// closed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+func main() {
+	port := flag.Int("port", 5670, "UDP beacon port")
+	flag.Parse()
+
+	node, err := zyre.New("interop",
+		zyre.SetPort(*port),
+		zyre.SetHeader("X-INTEROP", "%s", "echo"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer node.Destroy()
+	if err := node.Join("INTEROP"); err != nil {
+		log.Fatal(err)
+	}
+	if err := node.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer node.Stop()
+	fmt.Println(node.UUID())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		cancel()
+	}()
+	events, errs := node.Events(ctx)
+	go func() {
+		for err := range errs {
+			log.Print(err)
+		}
+	}()
+	for e := range events {
+		switch m := e.(type) {
+		case zyre.Whisper:
+			node.Whisper(m.Peer, m.Message...)
+		case zyre.Shout:
+			node.Shout(m.Group, m.Message...)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package testpeer runs nodes for tests of packages which receive events
+// through Dispatch
+package testpeer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+// Peer is a node whose events are fed to Dispatch of the tested package
+type Peer struct {
+	Node *zyre.Node
+	// UUID of the node, it is available after Close
+	UUID   string
+	enter  chan string
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New creates node with name on beacon port, nodes of one package use the
+// same port. The node is started by Start.
+func New(t testing.TB, name string, port int) *Peer {
+	node, err := zyre.New(name, zyre.SetPort(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Peer{
+		Node:  node,
+		UUID:  node.UUID(),
+		enter: make(chan string, 16),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start passes events of the node to dispatch and starts the node, ENTER
+// events not consumed by dispatch are kept for WaitEnter
+func (p *Peer) Start(t testing.TB, dispatch func(zyre.Event) bool) {
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	events, _ := p.Node.Events(ctx)
+	go func() {
+		defer close(p.done)
+		for e := range events {
+			if dispatch(e) {
+				continue
+			}
+			if e.Type() == zyre.EventEnter {
+				select {
+				case p.enter <- e.PeerID():
+				default:
+				}
+			}
+		}
+	}()
+	if err := p.Node.Start(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Close stops dispatching events, then stops and destroys the node. Close
+// may be called more than once.
+func (p *Peer) Close() {
+	p.once.Do(func() {
+		if p.cancel != nil {
+			p.cancel()
+			<-p.done
+		}
+		p.Node.Stop()
+		p.Node.Destroy()
+	})
+}
+
+// WaitEnter waits for ENTER of peer with uuid, fails the test after 5s
+func (p *Peer) WaitEnter(t testing.TB, uuid string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case id := <-p.enter:
+			if id == uuid {
+				return
+			}
+		case <-timeout:
+			t.Fatal("ENTER not received")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zre
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// BeaconSize is the size of ZRE discovery beacon
+const BeaconSize = 22
+
+// beaconVersion is the version of ZRE discovery beacon
+const beaconVersion = 0x01
+
+// ErrBeacon is returned when UDP datagram isn't a valid ZRE beacon
+var ErrBeacon = errors.New("zre: invalid beacon")
+
+// Beacon is a ZRE discovery beacon, broadcasted over UDP. Port is the TCP
+// port of node inbox, zero port means the node is going away.
+type Beacon struct {
+	UUID [16]byte
+	Port uint16
+}
+
+// Marshal encodes beacon
+func (b Beacon) Marshal() []byte {
+	p := make([]byte, BeaconSize)
+	copy(p, "ZRE")
+	p[3] = beaconVersion
+	copy(p[4:20], b.UUID[:])
+	binary.BigEndian.PutUint16(p[20:], b.Port)
+	return p
+}
+
+// UnmarshalBeacon decodes beacon from UDP datagram
+func UnmarshalBeacon(p []byte) (b Beacon, err error) {
+	if len(p) != BeaconSize || string(p[:3]) != "ZRE" || p[3] != beaconVersion {
+		err = ErrBeacon
+		return
+	}
+	copy(b.UUID[:], p[4:20])
+	b.Port = binary.BigEndian.Uint16(p[20:])
+	return
+}
+
+// ListenBeacon opens UDP socket for sending and receiving beacons on port.
+// Several sockets can listen on the same port, so more nodes can run on one
+// host.
+func ListenBeacon(port int) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: reuseAddr,
+	}
+	return lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf("0.0.0.0:%d", port))
+}
+
+// Interface returns address of network interface used for beacons and its
+// broadcast address. Name is a name of the interface or its IPv4 address,
+// empty name means the value of ZSYS_INTERFACE environment variable, or the
+// first interface which is up and can broadcast, or loopback if there is none.
+// Name "*" uses the first interface and broadcasts to 255.255.255.255.
+func Interface(name string) (ip net.IP, broadcast net.IP, err error) {
+	if name == "" {
+		name = os.Getenv("ZSYS_INTERFACE")
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	var loopback *net.IPNet
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			switch {
+			case name == "" || name == "*":
+				if iface.Flags&net.FlagLoopback != 0 {
+					if loopback == nil {
+						loopback = ipnet
+					}
+					continue
+				}
+				if iface.Flags&net.FlagBroadcast == 0 {
+					continue
+				}
+			case name != iface.Name && name != ipnet.IP.String():
+				continue
+			}
+			ip, broadcast = ipnet.IP.To4(), broadcastAddr(ipnet)
+			if name == "*" {
+				broadcast = net.IPv4bcast
+			}
+			return ip, broadcast, nil
+		}
+	}
+	if (name == "" || name == "*") && loopback != nil {
+		return loopback.IP.To4(), broadcastAddr(loopback), nil
+	}
+	err = fmt.Errorf("zre: no usable interface %s", strings.TrimSpace(name))
+	return
+}
+
+func broadcastAddr(ipnet *net.IPNet) net.IP {
+	ip := ipnet.IP.To4()
+	mask := ipnet.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	b := make(net.IP, net.IPv4len)
+	for i := range b {
+		b[i] = ip[i] | ^mask[i]
+	}
+	return b
+}
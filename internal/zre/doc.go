@@ -0,0 +1,8 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package zre implements wire formats of ZeroMQ Realtime Exchange Protocol
+// (https://rfc.zeromq.org/spec:36/ZRE) and a minimal ZMTP 3.0 transport,
+// which is enough for pure Go backend of gozyre to talk to C zyre peers.
+package zre
@@ -0,0 +1,235 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zre
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Signature of ZRE messages, 0xAAA0 | 1
+const Signature = 0xAAA1
+
+// Version of ZRE protocol
+const Version = 2
+
+// IDs of ZRE messages
+const (
+	Hello    = 1
+	Whisper  = 2
+	Shout    = 3
+	Join     = 4
+	Leave    = 5
+	Ping     = 6
+	PingOK   = 7
+	Election = 8
+	Leader   = 9
+)
+
+var (
+	// ErrSignature is returned when message does not start with ZRE signature
+	ErrSignature = errors.New("zre: invalid signature")
+
+	// ErrMalformed is returned when message is truncated or has bad content
+	ErrMalformed = errors.New("zre: malformed message")
+)
+
+// Msg is a ZRE message. Fields not used by a message ID are ignored.
+type Msg struct {
+	ID       uint8
+	Sequence uint16
+
+	// Hello
+	Endpoint string
+	Groups   []string
+	Status   uint8
+	Name     string
+	Headers  map[string]string
+
+	// Shout, Join, Leave, Election, Leader
+	Group string
+
+	// Election (challenger id) and Leader (leader id)
+	PeerID string
+
+	// Whisper, Shout, sent as additional frames
+	Content [][]byte
+}
+
+// Marshal encodes message into frames. The first frame is the message itself,
+// Whisper and Shout content follows as additional frames.
+func (m *Msg) Marshal() [][]byte {
+	b := make([]byte, 0, 64)
+	b = putNumber2(b, Signature)
+	b = append(b, m.ID, Version)
+	b = putNumber2(b, m.Sequence)
+	switch m.ID {
+	case Hello:
+		b = putString(b, m.Endpoint)
+		b = putNumber4(b, uint32(len(m.Groups)))
+		for _, g := range m.Groups {
+			b = putLongstr(b, g)
+		}
+		b = append(b, m.Status)
+		b = putString(b, m.Name)
+		b = putNumber4(b, uint32(len(m.Headers)))
+		// sort keys, so the output is stable
+		keys := make([]string, 0, len(m.Headers))
+		for k := range m.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b = putString(b, k)
+			b = putLongstr(b, m.Headers[k])
+		}
+	case Shout:
+		b = putString(b, m.Group)
+	case Join, Leave:
+		b = putString(b, m.Group)
+		b = append(b, m.Status)
+	case Election, Leader:
+		b = putString(b, m.Group)
+		b = putString(b, m.PeerID)
+	}
+	frames := [][]byte{b}
+	if m.ID == Whisper || m.ID == Shout {
+		frames = append(frames, m.Content...)
+	}
+	return frames
+}
+
+// Unmarshal decodes message from frames received from the network
+func Unmarshal(frames [][]byte) (*Msg, error) {
+	if len(frames) == 0 {
+		return nil, ErrMalformed
+	}
+	r := reader{b: frames[0]}
+	if r.number2() != Signature || r.err != nil {
+		return nil, ErrSignature
+	}
+	m := &Msg{}
+	m.ID = r.number1()
+	version := r.number1()
+	m.Sequence = r.number2()
+	if r.err != nil {
+		return nil, ErrMalformed
+	}
+	if version != Version {
+		return nil, fmt.Errorf("zre: unsupported version %d", version)
+	}
+	switch m.ID {
+	case Hello:
+		m.Endpoint = r.string()
+		n := r.number4()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			m.Groups = append(m.Groups, r.longstr())
+		}
+		m.Status = r.number1()
+		m.Name = r.string()
+		n = r.number4()
+		m.Headers = make(map[string]string)
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			k := r.string()
+			m.Headers[k] = r.longstr()
+		}
+	case Whisper, Ping, PingOK:
+	case Shout:
+		m.Group = r.string()
+	case Join, Leave:
+		m.Group = r.string()
+		m.Status = r.number1()
+	case Election, Leader:
+		m.Group = r.string()
+		m.PeerID = r.string()
+	default:
+		return nil, fmt.Errorf("zre: unknown message id %d", m.ID)
+	}
+	if r.err != nil {
+		return nil, ErrMalformed
+	}
+	if m.ID == Whisper || m.ID == Shout {
+		m.Content = frames[1:]
+	}
+	return m, nil
+}
+
+func putNumber2(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func putNumber4(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// putString appends short string, longer strings are truncated to 255 bytes
+func putString(b []byte, s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b = append(b, byte(len(s)))
+	return append(b, s...)
+}
+
+func putLongstr(b []byte, s string) []byte {
+	b = putNumber4(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// reader decodes fields of a frame, it records the first error and returns
+// zero values afterwards
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || n > len(r.b) {
+		r.err = ErrMalformed
+		return nil
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *reader) number1() uint8 {
+	p := r.next(1)
+	if p == nil {
+		return 0
+	}
+	return p[0]
+}
+
+func (r *reader) number2() uint16 {
+	p := r.next(2)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(p)
+}
+
+func (r *reader) number4() uint32 {
+	p := r.next(4)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p)
+}
+
+func (r *reader) string() string {
+	return string(r.next(int(r.number1())))
+}
+
+func (r *reader) longstr() string {
+	n := r.number4()
+	if uint64(n) > uint64(len(r.b)) {
+		r.err = ErrMalformed
+		return ""
+	}
+	return string(r.next(int(n)))
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zre
+
+import (
+	"syscall"
+)
+
+// reuseAddr sets SO_REUSEADDR, on Linux it is enough for more UDP sockets
+// to bind the same port and receive broadcasts
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
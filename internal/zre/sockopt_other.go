@@ -0,0 +1,18 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package zre
+
+import (
+	"syscall"
+)
+
+// reuseAddr does nothing on this platform, only one node per host can
+// listen for beacons on a port
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zre
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// ZMTP 3.0 (https://rfc.zeromq.org/spec:23/ZMTP) with NULL security
+// mechanism, it is all ZRE needs from libzmq: a DEALER connecting to a peer
+// and a ROUTER accepting connections from peers.
+
+const (
+	greetingSize = 64
+
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// MaxFrameSize limits size of received frames, connection with larger frame
+// fails with ErrFrameTooLarge
+const MaxFrameSize = 256 << 20
+
+var (
+	// ErrGreeting is returned when peer is not ZMTP 3.x with NULL mechanism
+	ErrGreeting = errors.New("zmtp: invalid greeting")
+
+	// ErrHandshake is returned when peer does not send valid READY command
+	ErrHandshake = errors.New("zmtp: invalid handshake")
+
+	// ErrFrameTooLarge is returned when peer sends frame above MaxFrameSize
+	ErrFrameTooLarge = errors.New("zmtp: frame too large")
+)
+
+// Conn is a ZMTP 3.0 connection with NULL security mechanism. Send can be
+// called concurrently with Recv.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// Socket-Type and Identity properties of peer
+	PeerSocketType string
+	PeerIdentity   []byte
+}
+
+// Handshake performs ZMTP greeting and NULL handshake on conn, announcing
+// socketType ("DEALER", "ROUTER") and identity. The caller should set
+// a deadline on conn, handshake blocks until peer answers.
+func Handshake(conn net.Conn, socketType string, identity []byte) (*Conn, error) {
+	c := &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	greeting := make([]byte, greetingSize)
+	greeting[0] = 0xFF
+	greeting[9] = 0x7F
+	greeting[10] = 3 // version major
+	greeting[11] = 0 // version minor
+	copy(greeting[12:32], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		return nil, err
+	}
+
+	peer := make([]byte, greetingSize)
+	if _, err := io.ReadFull(c.r, peer); err != nil {
+		return nil, err
+	}
+	if peer[0] != 0xFF || peer[9]&0x01 != 0x01 || peer[10] < 3 {
+		return nil, ErrGreeting
+	}
+	if string(bytes.TrimRight(peer[12:32], "\x00")) != "NULL" {
+		return nil, ErrGreeting
+	}
+
+	ready := []byte{5}
+	ready = append(ready, "READY"...)
+	ready = appendProperty(ready, "Socket-Type", []byte(socketType))
+	ready = appendProperty(ready, "Identity", identity)
+	if err := c.send([][]byte{ready}, flagCommand); err != nil {
+		return nil, err
+	}
+
+	flags, body, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagCommand == 0 {
+		return nil, ErrHandshake
+	}
+	name, data, err := parseCommand(body)
+	if err != nil {
+		return nil, err
+	}
+	if name == "ERROR" {
+		return nil, fmt.Errorf("zmtp: peer refused handshake: %s", data)
+	}
+	if name != "READY" {
+		return nil, ErrHandshake
+	}
+	props, err := parseProperties(data)
+	if err != nil {
+		return nil, err
+	}
+	c.PeerSocketType = string(props["Socket-Type"])
+	c.PeerIdentity = props["Identity"]
+	return c, nil
+}
+
+// Send sends multi-part message
+func (c *Conn) Send(frames [][]byte) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	return c.send(frames, 0)
+}
+
+// Recv receives next multi-part message. ZMTP commands sent by peer between
+// messages are handled internally, PING is answered by PONG.
+func (c *Conn) Recv() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			if err := c.command(body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		frames = append(frames, body)
+		if flags&flagMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+// Close closes underlying connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// RemoteAddr returns address of peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) command(body []byte) error {
+	name, data, err := parseCommand(body)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "PING":
+		// PING: TTL (2 bytes) and context, PONG echoes the context
+		if len(data) < 2 {
+			return ErrHandshake
+		}
+		pong := []byte{4}
+		pong = append(pong, "PONG"...)
+		pong = append(pong, data[2:]...)
+		return c.send([][]byte{pong}, flagCommand)
+	case "ERROR":
+		return fmt.Errorf("zmtp: peer sent error: %s", data)
+	}
+	// other commands (PONG, SUBSCRIBE, ...) are not interesting for ZRE
+	return nil
+}
+
+func (c *Conn) send(frames [][]byte, flags byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for i, f := range frames {
+		fl := flags
+		if i < len(frames)-1 {
+			fl |= flagMore
+		}
+		if len(f) > 255 {
+			var size [8]byte
+			binary.BigEndian.PutUint64(size[:], uint64(len(f)))
+			c.w.WriteByte(fl | flagLong)
+			c.w.Write(size[:])
+		} else {
+			c.w.WriteByte(fl)
+			c.w.WriteByte(byte(len(f)))
+		}
+		if _, err := c.w.Write(f); err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
+
+func (c *Conn) readFrame() (flags byte, body []byte, err error) {
+	flags, err = c.r.ReadByte()
+	if err != nil {
+		return
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var p [8]byte
+		if _, err = io.ReadFull(c.r, p[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(p[:])
+	} else {
+		var b byte
+		b, err = c.r.ReadByte()
+		if err != nil {
+			return
+		}
+		size = uint64(b)
+	}
+	if size > MaxFrameSize {
+		err = ErrFrameTooLarge
+		return
+	}
+	// do not trust the size, buffer grows only as data arrives
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, c.r, int64(size))
+	if err != nil {
+		if err == io.EOF && uint64(n) < size {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	body = buf.Bytes()
+	if body == nil {
+		body = []byte{}
+	}
+	return
+}
+
+func appendProperty(b []byte, name string, value []byte) []byte {
+	b = append(b, byte(len(name)))
+	b = append(b, name...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(value)))
+	b = append(b, size[:]...)
+	return append(b, value...)
+}
+
+func parseCommand(body []byte) (name string, data []byte, err error) {
+	if len(body) < 1 || int(body[0]) > len(body)-1 {
+		err = ErrHandshake
+		return
+	}
+	n := int(body[0])
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
+
+func parseProperties(data []byte) (map[string][]byte, error) {
+	props := make(map[string][]byte)
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return nil, ErrHandshake
+		}
+		name := string(data[1 : 1+n])
+		data = data[1+n:]
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(size) > uint64(len(data)) {
+			return nil, ErrHandshake
+		}
+		props[name] = data[:size]
+		data = data[size:]
+	}
+	return props, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zre
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsg(t *testing.T) {
+
+	assert := assert.New(t)
+
+	msgs := []*Msg{
+		{
+			ID:       Hello,
+			Sequence: 1,
+			Endpoint: "tcp://192.168.1.1:49152",
+			Groups:   []string{"GLOBAL", "LOCAL"},
+			Status:   2,
+			Name:     "node",
+			Headers:  map[string]string{"X-HELLO": "World"},
+		},
+		{ID: Whisper, Sequence: 2, Content: [][]byte{[]byte("hello"), {}}},
+		{ID: Shout, Sequence: 3, Group: "GLOBAL", Content: [][]byte{[]byte("hello")}},
+		{ID: Join, Sequence: 4, Group: "GLOBAL", Status: 3},
+		{ID: Leave, Sequence: 5, Group: "GLOBAL", Status: 4},
+		{ID: Ping, Sequence: 6},
+		{ID: PingOK, Sequence: 7},
+		{ID: Leader, Sequence: 8, Group: "GLOBAL", PeerID: "ABCD"},
+	}
+	for _, m := range msgs {
+		got, err := Unmarshal(m.Marshal())
+		assert.NoError(err)
+		if m.ID == Hello {
+			assert.Equal(m, got)
+		} else {
+			assert.Equal(m.ID, got.ID)
+			assert.Equal(m.Sequence, got.Sequence)
+			assert.Equal(m.Group, got.Group)
+			assert.Equal(m.Status, got.Status)
+			assert.Equal(m.PeerID, got.PeerID)
+			assert.Equal(m.Content, got.Content)
+		}
+	}
+
+	// wire format of PING as sent by libzyre
+	assert.Equal([][]byte{{0xAA, 0xA1, Ping, Version, 0x00, 0x06}}, msgs[5].Marshal())
+
+	_, err := Unmarshal([][]byte{{0xAA, 0xA0, Ping, Version, 0x00, 0x06}})
+	assert.Equal(ErrSignature, err)
+	_, err = Unmarshal([][]byte{{0xAA, 0xA1, Ping, 1, 0x00, 0x06}})
+	assert.Error(err)
+	hello := msgs[0].Marshal()[0]
+	for i := 0; i != len(hello); i++ {
+		_, err = Unmarshal([][]byte{hello[:i]})
+		assert.Error(err)
+	}
+}
+
+func TestBeacon(t *testing.T) {
+
+	assert := assert.New(t)
+
+	b := Beacon{Port: 49152}
+	copy(b.UUID[:], bytes.Repeat([]byte{0x42}, 16))
+	p := b.Marshal()
+	assert.Len(p, BeaconSize)
+	assert.Equal([]byte("ZRE\x01"), p[:4])
+	assert.Equal([]byte{0xC0, 0x00}, p[20:])
+
+	got, err := UnmarshalBeacon(p)
+	assert.NoError(err)
+	assert.Equal(b, got)
+
+	p[3] = 0x02
+	_, err = UnmarshalBeacon(p)
+	assert.Equal(ErrBeacon, err)
+	_, err = UnmarshalBeacon(p[:10])
+	assert.Equal(ErrBeacon, err)
+
+	ip, broadcast, err := Interface("lo")
+	if err == nil {
+		assert.Equal("127.0.0.1", ip.String())
+		assert.Equal("127.255.255.255", broadcast.String())
+	}
+	_, _, err = Interface("no-such-interface")
+	assert.Error(err)
+}
+
+func TestConn(t *testing.T) {
+
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	accepted := make(chan result)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- result{nil, err}
+			return
+		}
+		c, err := Handshake(conn, "ROUTER", nil)
+		accepted <- result{c, err}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(err)
+	dealer, err := Handshake(conn, "DEALER", []byte("\x01identity"))
+	assert.NoError(err)
+	defer dealer.Close()
+	r := <-accepted
+	assert.NoError(r.err)
+	router := r.conn
+	defer router.Close()
+
+	assert.Equal("ROUTER", dealer.PeerSocketType)
+	assert.Equal("DEALER", router.PeerSocketType)
+	assert.Equal([]byte("\x01identity"), router.PeerIdentity)
+
+	big := bytes.Repeat([]byte("x"), 70000)
+	msg := [][]byte{[]byte("hello"), {}, big}
+	go dealer.Send(msg)
+	got, err := router.Recv()
+	assert.NoError(err)
+	assert.Equal(msg, got)
+
+	// PING command is answered by PONG and does not interrupt messages
+	go func() {
+		ping := []byte{4}
+		ping = append(ping, "PING"...)
+		ping = append(ping, 0, 10, 'c', 't', 'x')
+		router.send([][]byte{ping}, flagCommand)
+		router.Send([][]byte{[]byte("reply")})
+	}()
+	got, err = dealer.Recv()
+	assert.NoError(err)
+	assert.Equal([][]byte{[]byte("reply")}, got)
+	flags, body, err := router.readFrame()
+	assert.NoError(err)
+	assert.Equal(byte(flagCommand), flags)
+	assert.Equal([]byte("\x04PONGctx"), body)
+}
+
+func TestFrameTooLarge(t *testing.T) {
+
+	assert := assert.New(t)
+
+	frame := []byte{flagLong, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	c := &Conn{r: bufio.NewReader(bytes.NewReader(frame))}
+	_, _, err := c.readFrame()
+	assert.Equal(ErrFrameTooLarge, err)
+
+	frame = []byte{flagLong, 0, 0, 0, 0, 0x10, 0, 0, 1}
+	c = &Conn{r: bufio.NewReader(bytes.NewReader(frame))}
+	_, _, err = c.readFrame()
+	assert.Equal(ErrFrameTooLarge, err)
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build interop && !purego && cgo
+// +build interop,!purego,cgo
+
+package zyre
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInterop talks to a peer with pure Go backend, it runs in another
+// process as the backends can't be linked together
+func TestInterop(t *testing.T) {
+
+	assert := assert.New(t)
+
+	cmd := exec.Command("go", "run", "-tags", "purego", "./internal/interop", "-port", "5689")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := strings.TrimSpace(line)
+
+	node := newTestNode(t, "cgo", SetPort(5689))
+	defer node.Destroy()
+	assert.NoError(node.Join("INTEROP"))
+	assert.NoError(node.Start())
+	defer node.Stop()
+
+	// next returns next event of type from the peer
+	next := func(typ EventType) Event {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			e, err := node.RecvTimeout(time.Until(deadline))
+			if err == nil && e.Type() == typ && e.PeerID() == peer {
+				return e
+			}
+		}
+		t.Fatalf("%s not received", typ)
+		return nil
+	}
+
+	enter := next(EventEnter).(Enter)
+	assert.Equal("interop", enter.Name)
+	assert.Equal("echo", enter.Headers["X-INTEROP"])
+	assert.Equal("INTEROP", next(EventJoin).(Join).Group)
+
+	assert.NoError(node.Whisper(peer, []byte("hello"), []byte("world")))
+	assert.Equal([][]byte{[]byte("hello"), []byte("world")}, next(EventWhisper).(Whisper).Message)
+
+	assert.NoError(node.Shout("INTEROP", []byte("ping")))
+	shout := next(EventShout).(Shout)
+	assert.Equal("INTEROP", shout.Group)
+	assert.Equal([][]byte{[]byte("ping")}, shout.Message)
+
+	stdin.Close()
+	next(EventExit)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rss returns resident set size of the process or -1 if unknown
+func rss() int64 {
+	b, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return -1
+	}
+	var size, resident int64
+	if _, err := fmt.Sscan(string(b), &size, &resident); err != nil {
+		return -1
+	}
+	runtime.GC()
+	debug.FreeOSMemory()
+	return resident * int64(os.Getpagesize())
+}
+
+func TestLeak(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping leak test in short mode")
+	}
+	if rss() == -1 {
+		t.Skip("can't read RSS of the process")
+	}
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5673))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5673))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+	assert.NoError(node.Join("LEAK"))
+	assert.NoError(node2.Join("LEAK"))
+
+	for joined := false; !joined; {
+		m, err := node.RecvTimeout(5 * time.Second)
+		if !assert.NoError(err) {
+			return
+		}
+		if j, ok := m.(Join); ok && j.Peer == node2.UUID() {
+			joined = true
+		}
+	}
+
+	// every leaked C string of payload costs 4kB, so a leak is apparent
+	payload := strings.Repeat("x", 4096)
+	send := func(n int) bool {
+		const batch = 100
+		for i := 0; i < n; i += batch {
+			for j := 0; j != batch; j++ {
+				node.WhisperString(node2.UUID(), "%s", payload)
+				node.ShoutString("LEAK", "%s", payload)
+				node.Whisper(node2.UUID(), []byte(payload))
+				node.Shout("LEAK", []byte(payload))
+			}
+			for j := 0; j != 4*batch; {
+				m, err := node2.RecvTimeout(5 * time.Second)
+				if !assert.NoError(err) {
+					return false
+				}
+				switch m.(type) {
+				case Whisper, Shout:
+					j++
+				}
+			}
+		}
+		return true
+	}
+
+	// warm up allocators and queues first
+	if !send(1000) {
+		return
+	}
+	before := rss()
+	if !send(10000) {
+		return
+	}
+	after := rss()
+
+	// 10000 x 2 leaked payloads would be 80MB
+	growth := after - before
+	t.Logf("RSS before=%d after=%d growth=%d", before, after, growth)
+	assert.True(growth < 32<<20, "RSS grew by %d bytes", growth)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNew is returned when node can't be created
+	ErrNew = errors.New("zyre_new returned NULL")
+
+	// ErrConfig is returned (wrapped) for invalid configuration of node
+	ErrConfig = errors.New("invalid configuration")
+
+	// ErrStart is returned when node fails to start
+	ErrStart = errors.New("zyre_start returned -1")
+
+	// ErrJoin is returned when node fails to join the group
+	ErrJoin = errors.New("zyre_join returned -1")
+
+	// ErrLeave is returned when node fails to leave the group
+	ErrLeave = errors.New("zyre_leave returned -1")
+
+	// ErrRecvNil is returned when recv got nil pointer or the node is
+	// destroyed
+	ErrRecvNil = errors.New("zyre_recv got nil")
+
+	// ErrRecvNilEvent is returned when recv got nil pointer
+	ErrRecvNilEvent = errors.New("zyre_recv got nil event")
+
+	// ErrPoll is returned when polling of zyre_socket fails
+	ErrPoll = errors.New("zmq_poll returned -1")
+
+	// ErrPollEmpty is returned by Poller.Wait without timeout when nothing
+	// is registered, it would wait forever
+	ErrPollEmpty = errors.New("poller is empty")
+
+	// ErrNotSupported is returned when the backend does not support
+	// a feature, eg. gossip discovery in pure Go backend
+	ErrNotSupported = errors.New("not supported by this backend")
+)
+
+// Option is a type for setting up the underlying Zyre actor, it returns
+// error for invalid values
+type Option func(*Node) error
+
+// apply applies options to a new node, the node is destroyed if an option
+// fails
+func (z *Node) apply(options []Option) (*Node, error) {
+	for _, o := range options {
+		if err := o(z); err != nil {
+			z.Destroy()
+			return nil, err
+		}
+	}
+	return z, nil
+}
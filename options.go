@@ -2,6 +2,9 @@
 // Use of this source code is governed by a MPL-2.0
 // license that can be found in the LICENSE file.
 
+//go:build !purego && cgo
+// +build !purego,cgo
+
 package zyre
 
 //#cgo pkg-config: libzyre
@@ -17,52 +20,63 @@ import (
 )
 
 // SetHeader - set node header; these are provided to other nodes during
-// discovery and come in each ENTER message.
-func (z *Node) SetHeader(name string, format string, a ...interface{}) {
-	if z.ptr == nil {
-		panic("Node.SetHeader: z.ptr is null")
+// discovery and come in each ENTER message. Fails with ErrConfig for empty
+// name or name longer than 255 bytes.
+func (z *Node) SetHeader(name string, format string, a ...interface{}) error {
+	if err := checkHeader(name); err != nil {
+		return err
 	}
-	s := fmt.Sprintf(format, a...)
+	z.lock("Node.SetHeader")
+	defer z.mu.Unlock()
+	cname, free := cString(name)
+	defer free()
+	cs, free := cString(fmt.Sprintf(format, a...))
+	defer free()
 	C._zyre_set_header(
 		z.ptr,
-		C.CString(name),
-		C.CString(s))
+		cname,
+		cs)
+	return nil
 }
 
 func SetHeader(name string, format string, a ...interface{}) Option {
-	return func(z *Node) {
-		z.SetHeader(name, format, a...)
+	return func(z *Node) error {
+		return z.SetHeader(name, format, a...)
 	}
 }
 
 // SetVerbose verbose mode; this tells the node to log all traffic as well as
 // all major events.
 func (z *Node) SetVerbose() {
-	if z.ptr == nil {
-		panic("Node.SetVerbose: z.ptr is null")
-	}
+	z.lock("Node.SetVerbose")
+	defer z.mu.Unlock()
 	C.zyre_set_verbose(z.ptr)
 }
 
 func SetVerbose() Option {
-	return func(z *Node) {
+	return func(z *Node) error {
 		z.SetVerbose()
+		return nil
 	}
 }
 
 // SetPort - Set UDP beacon discovery port; defaults to 5670, this call overrides
 // that so you can create independent clusters on the same network, for
-// e.g. development vs. production. Has no effect after Start()
-func (z *Node) SetPort(port int) {
-	if z.ptr == nil {
-		panic("Node.SetPort: z.ptr is null")
+// e.g. development vs. production. Has no effect after Start(). Fails with
+// ErrConfig for port out of range 1-65535.
+func (z *Node) SetPort(port int) error {
+	if err := checkPort(port); err != nil {
+		return err
 	}
+	z.lock("Node.SetPort")
+	defer z.mu.Unlock()
 	C.zyre_set_port(z.ptr, C.int(port))
+	return nil
 }
 
 func SetPort(port int) Option {
-	return func(z *Node) {
-		z.SetPort(port)
+	return func(z *Node) error {
+		return z.SetPort(port)
 	}
 }
 
@@ -70,16 +84,20 @@ func SetPort(port int) Option {
 // millisecond.  This can be tuned in order to deal with expected network
 // conditions and the response time expected by the application. This is tied
 // to the beacon interval and rate of messages received.
-func (z *Node) SetEvasiveTimeout(interval time.Duration) {
-	if z.ptr == nil {
-		panic("Node.SetEvasiveTimeout: z.ptr is null")
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetEvasiveTimeout(interval time.Duration) error {
+	if err := checkDuration("evasive timeout", interval); err != nil {
+		return err
 	}
+	z.lock("Node.SetEvasiveTimeout")
+	defer z.mu.Unlock()
 	C.zyre_set_evasive_timeout(z.ptr, C.int(interval.Nanoseconds()/1000000))
+	return nil
 }
 
 func SetEvasiveTimeout(interval time.Duration) Option {
-	return func(z *Node) {
-		z.SetEvasiveTimeout(interval)
+	return func(z *Node) error {
+		return z.SetEvasiveTimeout(interval)
 	}
 }
 
@@ -87,31 +105,39 @@ func SetEvasiveTimeout(interval time.Duration) Option {
 // This can be tuned in order to deal with expected network
 // conditions and the response time expected by the application. This is tied
 // to the beacon interval and rate of messages received.
-func (z *Node) SetExpiredTimeout(interval time.Duration) {
-	if z.ptr == nil {
-		panic("Node.SetExpiredTimeout: z.ptr is null")
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetExpiredTimeout(interval time.Duration) error {
+	if err := checkDuration("expired timeout", interval); err != nil {
+		return err
 	}
+	z.lock("Node.SetExpiredTimeout")
+	defer z.mu.Unlock()
 	C.zyre_set_expired_timeout(z.ptr, C.int(interval.Nanoseconds()/1000000))
+	return nil
 }
 
 func SetExpiredTimeout(interval time.Duration) Option {
-	return func(z *Node) {
-		z.SetExpiredTimeout(interval)
+	return func(z *Node) error {
+		return z.SetExpiredTimeout(interval)
 	}
 }
 
 // SetInterval - Set UDP beacon discovery interval, in milliseconds. Default
 // is instant beacon exploration followed by pinging every 1,000 msecs.
-func (z *Node) SetInterval(interval time.Duration) {
-	if z.ptr == nil {
-		panic("Node.SetInterval: z.ptr is null")
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetInterval(interval time.Duration) error {
+	if err := checkDuration("interval", interval); err != nil {
+		return err
 	}
+	z.lock("Node.SetInterval")
+	defer z.mu.Unlock()
 	C.zyre_set_interval(z.ptr, C.size_t(interval.Nanoseconds()/1000000))
+	return nil
 }
 
 func SetInterval(interval time.Duration) Option {
-	return func(z *Node) {
-		z.SetInterval(interval)
+	return func(z *Node) error {
+		return z.SetInterval(interval)
 	}
 }
 
@@ -119,14 +145,16 @@ func SetInterval(interval time.Duration) Option {
 // CZMQ will choose an interface for you. On boxes with several interfaces you
 // should specify which one you want to use, or strange things can happen.
 func (z *Node) SetInterface(value string) {
-	if z.ptr == nil {
-		panic("Node.SetInterface: z.ptr is null")
-	}
-	C.zyre_set_interface(z.ptr, C.CString(value))
+	z.lock("Node.SetInterface")
+	defer z.mu.Unlock()
+	cvalue, free := cString(value)
+	defer free()
+	C.zyre_set_interface(z.ptr, cvalue)
 }
 
 func SetInterface(value string) Option {
-	return func(z *Node) {
+	return func(z *Node) error {
 		z.SetInterface(value)
+		return nil
 	}
 }
@@ -1,4 +1,5 @@
-// +build draft
+//go:build draft && !purego && cgo
+// +build draft,!purego,cgo
 
 package zyre
 
@@ -13,14 +14,17 @@ import (
 // Use SetBeaconPeerPort() to override the default with a well known value. 
 // Very useful to simplify firewall rules (because of randomness of default port).
 func (z *Node) SetBeaconPeerPort(port int) {
-	if z.ptr == nil {
-		panic("Node.SetBeaconPeerPort: z.ptr is null")
-	}
+	z.lock("Node.SetBeaconPeerPort")
+	defer z.mu.Unlock()
 	C.zyre_set_beacon_peer_port(z.ptr, C.int(port))
 }
 
 func SetBeaconPeerPort(port int) Option {
-	return func(z *Node) {
+	return func(z *Node) error {
+		if err := checkPort(port); err != nil {
+			return err
+		}
 		z.SetBeaconPeerPort(port)
+		return nil
 	}
 }
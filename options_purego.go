@@ -0,0 +1,132 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build purego || !cgo
+// +build purego !cgo
+
+package zyre
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetHeader - set node header; these are provided to other nodes during
+// discovery and come in each ENTER message. Fails with ErrConfig for empty
+// name or name longer than 255 bytes.
+func (z *Node) SetHeader(name string, format string, a ...interface{}) error {
+	if err := checkHeader(name); err != nil {
+		return err
+	}
+	s := fmt.Sprintf(format, a...)
+	z.call("Node.SetHeader", func() { z.headers[name] = s })
+	return nil
+}
+
+func SetHeader(name string, format string, a ...interface{}) Option {
+	return func(z *Node) error {
+		return z.SetHeader(name, format, a...)
+	}
+}
+
+// SetVerbose verbose mode; this tells the node to log all traffic as well as
+// all major events.
+func (z *Node) SetVerbose() {
+	z.call("Node.SetVerbose", func() { z.verbose = true })
+}
+
+func SetVerbose() Option {
+	return func(z *Node) error {
+		z.SetVerbose()
+		return nil
+	}
+}
+
+// SetPort - Set UDP beacon discovery port; defaults to 5670, this call overrides
+// that so you can create independent clusters on the same network, for
+// e.g. development vs. production. Has no effect after Start(). Fails with
+// ErrConfig for port out of range 1-65535.
+func (z *Node) SetPort(port int) error {
+	if err := checkPort(port); err != nil {
+		return err
+	}
+	z.call("Node.SetPort", func() { z.port = port })
+	return nil
+}
+
+func SetPort(port int) Option {
+	return func(z *Node) error {
+		return z.SetPort(port)
+	}
+}
+
+// SetEvasiveTimeout - Set the peer evasiveness timeout, Default is 5000
+// millisecond.  This can be tuned in order to deal with expected network
+// conditions and the response time expected by the application. This is tied
+// to the beacon interval and rate of messages received.
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetEvasiveTimeout(interval time.Duration) error {
+	if err := checkDuration("evasive timeout", interval); err != nil {
+		return err
+	}
+	z.call("Node.SetEvasiveTimeout", func() { z.evasive = interval })
+	return nil
+}
+
+func SetEvasiveTimeout(interval time.Duration) Option {
+	return func(z *Node) error {
+		return z.SetEvasiveTimeout(interval)
+	}
+}
+
+// SetExpiredTimeout - Set the peer expiration timeout, default is 30000 milliseconds.
+// This can be tuned in order to deal with expected network
+// conditions and the response time expected by the application. This is tied
+// to the beacon interval and rate of messages received.
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetExpiredTimeout(interval time.Duration) error {
+	if err := checkDuration("expired timeout", interval); err != nil {
+		return err
+	}
+	z.call("Node.SetExpiredTimeout", func() { z.expired = interval })
+	return nil
+}
+
+func SetExpiredTimeout(interval time.Duration) Option {
+	return func(z *Node) error {
+		return z.SetExpiredTimeout(interval)
+	}
+}
+
+// SetInterval - Set UDP beacon discovery interval, in milliseconds. Default
+// is instant beacon exploration followed by pinging every 1,000 msecs.
+// Fails with ErrConfig for interval shorter than 1ms.
+func (z *Node) SetInterval(interval time.Duration) error {
+	if err := checkDuration("interval", interval); err != nil {
+		return err
+	}
+	z.call("Node.SetInterval", func() { z.interval = interval })
+	return nil
+}
+
+func SetInterval(interval time.Duration) Option {
+	return func(z *Node) error {
+		return z.SetInterval(interval)
+	}
+}
+
+// SetInterface - Set network interface for UDP beacons. If you do not set this,
+// the first interface which can broadcast is used, or ZSYS_INTERFACE
+// environment variable as in CZMQ. On boxes with several interfaces you
+// should specify which one you want to use, or strange things can happen.
+func (z *Node) SetInterface(value string) {
+	z.call("Node.SetInterface", func() { z.iface = value })
+}
+
+func SetInterface(value string) Option {
+	return func(z *Node) error {
+		z.SetInterface(value)
+		return nil
+	}
+}
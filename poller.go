@@ -0,0 +1,98 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"sync"
+	"time"
+)
+
+// Poller waits for events of many nodes and for readable file descriptors,
+// so one goroutine can serve many nodes. Nodes are polled by the socket
+// returned by zyre_socket, inbox is not locked during Wait, so nodes
+// registered in a poller should be received only by the goroutine calling
+// Wait, otherwise Recv of a reported node may block. Destroy of a node
+// interrupts Wait, destroyed nodes are reported as readable.
+// File descriptors are not supported by pure Go backend.
+type Poller struct {
+	mu    sync.Mutex
+	nodes []*Node
+	fds   []int
+}
+
+// NewPoller creates a poller for nodes
+func NewPoller(nodes ...*Node) *Poller {
+	p := &Poller{}
+	for _, z := range nodes {
+		p.Add(z)
+	}
+	return p
+}
+
+// Add registers node in the poller
+func (p *Poller) Add(z *Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, n := range p.nodes {
+		if n == z {
+			return
+		}
+	}
+	p.nodes = append(p.nodes, z)
+}
+
+// Remove unregisters node from the poller
+func (p *Poller) Remove(z *Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, n := range p.nodes {
+		if n == z {
+			p.nodes = append(p.nodes[:i], p.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddFD registers file descriptor (eg. socket of other library) in the
+// poller, Wait reports it when it is readable
+func (p *Poller) AddFD(fd int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, f := range p.fds {
+		if f == fd {
+			return
+		}
+	}
+	p.fds = append(p.fds, fd)
+}
+
+// RemoveFD unregisters file descriptor from the poller
+func (p *Poller) RemoveFD(fd int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, f := range p.fds {
+		if f == fd {
+			p.fds = append(p.fds[:i], p.fds[i+1:]...)
+			return
+		}
+	}
+}
+
+// Wait waits at most timeout until some of registered nodes has an event to
+// Recv or some file descriptor is readable, negative timeout waits forever.
+// Returns readable nodes and file descriptors, both are empty on timeout or
+// when the wait was interrupted by a signal. Returns ErrNotSupported if file
+// descriptors are registered with pure Go backend, ErrPollEmpty for negative
+// timeout if nothing is registered.
+func (p *Poller) Wait(timeout time.Duration) (nodes []*Node, fds []int, err error) {
+	p.mu.Lock()
+	registered := append([]*Node(nil), p.nodes...)
+	registeredFds := append([]int(nil), p.fds...)
+	p.mu.Unlock()
+	if len(registered) == 0 && len(registeredFds) == 0 && timeout < 0 {
+		return nil, nil, ErrPollEmpty
+	}
+	return pollNodes(registered, registeredFds, timeout)
+}
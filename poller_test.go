@@ -0,0 +1,92 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoller(t *testing.T) {
+
+	assert := assert.New(t)
+
+	// two independent clusters served by one goroutine
+	a1 := newTestNode(t, "a1", SetPort(5677))
+	defer a1.Destroy()
+	a2 := newTestNode(t, "a2", SetPort(5677))
+	defer a2.Destroy()
+	b1 := newTestNode(t, "b1", SetPort(5678))
+	defer b1.Destroy()
+	b2 := newTestNode(t, "b2", SetPort(5678))
+	defer b2.Destroy()
+
+	poller := NewPoller(a1, b1)
+
+	// nothing to receive before start
+	start := time.Now()
+	nodes, fds, err := poller.Wait(50 * time.Millisecond)
+	assert.NoError(err)
+	assert.Empty(nodes)
+	assert.Empty(fds)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+
+	for _, n := range []*Node{a1, a2, b1, b2} {
+		assert.NoError(n.Start())
+	}
+
+	entered := map[string]string{}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(entered) < 2 && time.Now().Before(deadline) {
+		nodes, _, err := poller.Wait(time.Until(deadline))
+		if !assert.NoError(err) {
+			return
+		}
+		for _, n := range nodes {
+			m, err := n.Recv()
+			assert.NoError(err)
+			if e, ok := m.(Enter); ok {
+				entered[n.Name()] = e.Name
+			}
+		}
+	}
+	assert.Equal(map[string]string{"a1": "a2", "b1": "b2"}, entered)
+
+	poller.Remove(b1)
+	b2.Shout("NOBODY", []byte("ignored"))
+	b2.Stop()
+	nodes, _, err = poller.Wait(50 * time.Millisecond)
+	assert.NoError(err)
+	for _, n := range nodes {
+		assert.Equal(a1, n)
+	}
+
+	// empty poller can only time out
+	_, _, err = NewPoller().Wait(-1)
+	assert.Equal(ErrPollEmpty, err)
+	nodes, _, err = NewPoller().Wait(10 * time.Millisecond)
+	assert.NoError(err)
+	assert.Empty(nodes)
+
+	r, w, err := os.Pipe()
+	if !assert.NoError(err) {
+		return
+	}
+	defer r.Close()
+	defer w.Close()
+	fdPoller := NewPoller()
+	fdPoller.AddFD(int(r.Fd()))
+	w.Write([]byte("x"))
+	_, fds, err = fdPoller.Wait(time.Second)
+	if err == ErrNotSupported {
+		t.Log("file descriptors are not supported by backend")
+		return
+	}
+	assert.NoError(err)
+	assert.Equal([]int{int(r.Fd())}, fds)
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is passed to Reactor error handler when an event handler panics
+type PanicError struct {
+	Event Event
+	Value interface{}
+	Stack []byte
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("Reactor: %s handler panicked: %v", e.Event.Type(), e.Value)
+}
+
+// Reactor reads events from a Node and dispatches them to registered
+// handlers. Handlers are called sequentially from the goroutine calling Run,
+// they can be registered or replaced at any time, even when Run is running.
+type Reactor struct {
+	node *Node
+
+	mu        sync.RWMutex
+	onEnter   func(Enter)
+	onEvasive func(Evasive)
+	onExit    func(Exit)
+	onJoin    func(Join)
+	onLeave   func(Leave)
+	onWhisper func(Whisper)
+	onShout   map[string]func(Shout)
+	onStop    func(Stop)
+	onLeader  func(Leader)
+	onError   func(error)
+}
+
+// NewReactor creates a new Reactor dispatching events of node
+func NewReactor(node *Node) *Reactor {
+	return &Reactor{
+		node:    node,
+		onShout: make(map[string]func(Shout)),
+	}
+}
+
+// OnEnter registers handler for Enter events
+func (r *Reactor) OnEnter(h func(Enter)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onEnter = h
+}
+
+// OnEvasive registers handler for Evasive events
+func (r *Reactor) OnEvasive(h func(Evasive)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onEvasive = h
+}
+
+// OnExit registers handler for Exit events
+func (r *Reactor) OnExit(h func(Exit)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onExit = h
+}
+
+// OnJoin registers handler for Join events
+func (r *Reactor) OnJoin(h func(Join)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onJoin = h
+}
+
+// OnLeave registers handler for Leave events
+func (r *Reactor) OnLeave(h func(Leave)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onLeave = h
+}
+
+// OnWhisper registers handler for Whisper events
+func (r *Reactor) OnWhisper(h func(Whisper)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onWhisper = h
+}
+
+// OnShout registers handler for Shout events sent to group. Handler
+// registered for empty group gets shouts to all groups without
+// own handler. Nil handler removes the registration.
+func (r *Reactor) OnShout(group string, h func(Shout)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h == nil {
+		delete(r.onShout, group)
+		return
+	}
+	r.onShout[group] = h
+}
+
+// OnStop registers handler for Stop events
+func (r *Reactor) OnStop(h func(Stop)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onStop = h
+}
+
+// OnLeader registers handler for Leader events
+func (r *Reactor) OnLeader(h func(Leader)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onLeader = h
+}
+
+// OnError registers handler for errors which do not stop the Reactor,
+// a malformed message or PanicError from event handler. Errors are
+// dropped if there is no handler.
+func (r *Reactor) OnError(h func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onError = h
+}
+
+// Run - receives events from node and dispatches them to handlers until ctx
+// is done or the node can't receive anymore. Returns ctx.Err() or the
+// receive error. Panics in handlers are recovered and reported as PanicError
+// to OnError handler.
+func (r *Reactor) Run(ctx context.Context) error {
+	for {
+		m, err := r.node.RecvContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == ErrRecvNil || err == ErrPoll {
+				return err
+			}
+			r.error(err)
+			continue
+		}
+		r.dispatch(m)
+	}
+}
+
+func (r *Reactor) error(err error) {
+	r.mu.RLock()
+	h := r.onError
+	r.mu.RUnlock()
+	if h != nil {
+		h(err)
+	}
+}
+
+func (r *Reactor) dispatch(e Event) {
+	h := r.handler(e)
+	if h == nil {
+		return
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			r.error(PanicError{
+				Event: e,
+				Value: v,
+				Stack: debug.Stack(),
+			})
+		}
+	}()
+	h()
+}
+
+// handler returns registered handler bound to e, or nil. Lock is not held
+// when handler is called, so it is free to register other handlers.
+func (r *Reactor) handler(e Event) func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	switch m := e.(type) {
+	case Enter:
+		if h := r.onEnter; h != nil {
+			return func() { h(m) }
+		}
+	case Evasive:
+		if h := r.onEvasive; h != nil {
+			return func() { h(m) }
+		}
+	case Exit:
+		if h := r.onExit; h != nil {
+			return func() { h(m) }
+		}
+	case Join:
+		if h := r.onJoin; h != nil {
+			return func() { h(m) }
+		}
+	case Leave:
+		if h := r.onLeave; h != nil {
+			return func() { h(m) }
+		}
+	case Whisper:
+		if h := r.onWhisper; h != nil {
+			return func() { h(m) }
+		}
+	case Shout:
+		h, ok := r.onShout[m.Group]
+		if !ok {
+			h = r.onShout[""]
+		}
+		if h != nil {
+			return func() { h(m) }
+		}
+	case Stop:
+		if h := r.onStop; h != nil {
+			return func() { h(m) }
+		}
+	case Leader:
+		if h := r.onLeader; h != nil {
+			return func() { h(m) }
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReactorDispatch(t *testing.T) {
+
+	assert := assert.New(t)
+
+	r := NewReactor(nil)
+	var got []string
+	r.OnEnter(func(m Enter) { got = append(got, "enter "+m.Name) })
+	r.OnShout("A", func(m Shout) { got = append(got, "A "+m.Name) })
+	r.OnShout("", func(m Shout) { got = append(got, "* "+m.Name) })
+	r.OnWhisper(func(m Whisper) { panic("boom") })
+	var errs []error
+	r.OnError(func(err error) { errs = append(errs, err) })
+
+	r.dispatch(Enter{Name: "n1"})
+	r.dispatch(Shout{Name: "n2", Group: "A"})
+	r.dispatch(Shout{Name: "n3", Group: "B"})
+	r.dispatch(Exit{Name: "n4"})
+	r.dispatch(Whisper{Name: "n5"})
+
+	assert.Equal([]string{"enter n1", "A n2", "* n3"}, got)
+	assert.Len(errs, 1)
+	perr, ok := errs[0].(PanicError)
+	assert.True(ok)
+	assert.Equal("boom", perr.Value)
+	assert.Equal(EventWhisper, perr.Event.Type())
+
+	r.OnShout("", nil)
+	r.dispatch(Shout{Name: "n6", Group: "B"})
+	assert.Len(got, 3)
+}
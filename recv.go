@@ -2,6 +2,9 @@
 // Use of this source code is governed by a MPL-2.0
 // license that can be found in the LICENSE file.
 
+//go:build !purego && cgo
+// +build !purego,cgo
+
 package zyre
 
 //#cgo pkg-config: libzyre
@@ -19,65 +22,10 @@ import "C"
 
 import (
 	"fmt"
+	"time"
 	"unsafe"
 )
 
-// Enter - new peer has entered the network
-type Enter struct {
-	Peer     string
-	Name     string
-	Headers  map[string]string
-	Endpoint string
-}
-
-// Evasive - peer is being evasive (quiet for too long)
-type Evasive struct {
-	Peer string
-	Name string
-}
-
-// Exit - peer has left the network
-type Exit struct {
-	Peer string
-	Name string
-}
-
-// Join - peer has joined a specific group
-type Join struct {
-	Peer  string
-	Name  string
-	Group string
-}
-
-// Leave - peer has left a specific group
-type Leave struct {
-	Peer  string
-	Name  string
-	Group string
-}
-
-// Whisper -  peer has sent this node a message
-type Whisper struct {
-	Peer    string
-	Name    string
-	Message [][]byte
-}
-
-// Shout -  a peer has sent one of our groups a message
-type Shout struct {
-	Peer    string
-	Name    string
-	Group   string
-	Message [][]byte
-}
-
-// Stop - peer was stopped
-type Stop struct {
-	Peer string
-	Name string
-}
-
-
 func recvEnter(msg *C.zmsg_t) (m Enter, err error) {
 	cpeer := C.zmsg_popstr(msg)
 	if cpeer == nil {
@@ -100,7 +48,7 @@ func recvEnter(msg *C.zmsg_t) (m Enter, err error) {
 		err = fmt.Errorf("Zyre.Recv: ENTER got nil headers")
 		return
 	}
-	defer C.free(unsafe.Pointer(cheaders))
+	defer C.zframe_destroy(&cheaders)
 	chash := C.zhash_unpack(cheaders)
 	if chash == nil {
 		err = fmt.Errorf("Zyre.Recv: ENTER headers unpack failed")
@@ -128,6 +76,7 @@ func recvEnter(msg *C.zmsg_t) (m Enter, err error) {
 		Name:     name,
 		Headers:  headers,
 		Endpoint: ip,
+		at:       time.Now(),
 	}
 	return
 }
@@ -152,6 +101,7 @@ func recvEvasive(msg *C.zmsg_t) (m Evasive, err error) {
 	m = Evasive{
 		Peer: peer,
 		Name: name,
+		at:   time.Now(),
 	}
 	return
 }
@@ -176,6 +126,7 @@ func recvExit(msg *C.zmsg_t) (m Exit, err error) {
 	m = Exit{
 		Peer: peer,
 		Name: name,
+		at:   time.Now(),
 	}
 	return
 }
@@ -209,6 +160,7 @@ func recvJoin(msg *C.zmsg_t) (m Join, err error) {
 		Peer:  peer,
 		Name:  name,
 		Group: group,
+		at:    time.Now(),
 	}
 	return
 }
@@ -242,6 +194,7 @@ func recvLeave(msg *C.zmsg_t) (m Leave, err error) {
 		Peer:  peer,
 		Name:  name,
 		Group: group,
+		at:    time.Now(),
 	}
 	return
 }
@@ -263,23 +216,13 @@ func recvWhisper(msg *C.zmsg_t) (m Whisper, err error) {
 	name := C.GoString(cname)
 	defer C.free(unsafe.Pointer(cname))
 
-	message := make([][]byte, C.zmsg_size(msg))
-	i := 0
-	for {
-		p := C.zmsg_pop(msg)
-		if p == nil {
-			break
-		}
-		message[i] = C.GoBytes(
-			unsafe.Pointer(C.zframe_data(p)),
-			C.int(C.zframe_size(p)),
-		)
-	}
+	message := popFrames(msg)
 
 	m = Whisper{
 		Peer:    peer,
 		Name:    name,
 		Message: message,
+		at:      time.Now(),
 	}
 	return
 }
@@ -309,24 +252,14 @@ func recvShout(msg *C.zmsg_t) (m Shout, err error) {
 	group := C.GoString(cgroup)
 	defer C.free(unsafe.Pointer(cgroup))
 
-	message := make([][]byte, C.zmsg_size(msg))
-	i := 0
-	for {
-		p := C.zmsg_pop(msg)
-		if p == nil {
-			break
-		}
-		message[i] = C.GoBytes(
-			unsafe.Pointer(C.zframe_data(p)),
-			C.int(C.zframe_size(p)),
-		)
-	}
+	message := popFrames(msg)
 
 	m = Shout{
 		Peer:    peer,
 		Name:    name,
 		Group:   group,
 		Message: message,
+		at:      time.Now(),
 	}
 	return
 }
@@ -349,8 +282,60 @@ func recvStop(msg *C.zmsg_t) (m Stop, err error) {
 	defer C.free(unsafe.Pointer(cname))
 
 	m = Stop{
-		Peer:    peer,
-		Name:    name,
+		Peer: peer,
+		Name: name,
+		at:   time.Now(),
 	}
 	return
 }
+
+func recvLeader(msg *C.zmsg_t) (m Leader, err error) {
+	cpeer := C.zmsg_popstr(msg)
+	if cpeer == nil {
+		err = fmt.Errorf("Zyre.Recv: LEADER got nil peer")
+		return
+	}
+	peer := C.GoString(cpeer)
+	defer C.free(unsafe.Pointer(cpeer))
+
+	cname := C.zmsg_popstr(msg)
+	if cname == nil {
+		err = fmt.Errorf("Zyre.Recv: LEADER got nil name")
+		return
+	}
+	name := C.GoString(cname)
+	defer C.free(unsafe.Pointer(cname))
+
+	cgroup := C.zmsg_popstr(msg)
+	if cgroup == nil {
+		err = fmt.Errorf("Zyre.Recv: LEADER got nil group")
+		return
+	}
+	group := C.GoString(cgroup)
+	defer C.free(unsafe.Pointer(cgroup))
+
+	m = Leader{
+		Peer:  peer,
+		Name:  name,
+		Group: group,
+		at:    time.Now(),
+	}
+	return
+}
+
+// popFrames pops all remaining frames of msg and returns their content
+func popFrames(msg *C.zmsg_t) [][]byte {
+	message := make([][]byte, 0, C.zmsg_size(msg))
+	for {
+		p := C.zmsg_pop(msg)
+		if p == nil {
+			break
+		}
+		message = append(message, C.GoBytes(
+			unsafe.Pointer(C.zframe_data(p)),
+			C.int(C.zframe_size(p)),
+		))
+		C.zframe_destroy(&p)
+	}
+	return message
+}
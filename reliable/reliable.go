@@ -0,0 +1,409 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package reliable implements acknowledged delivery of whispers. Messages
+// are numbered per peer, receiver acknowledges every message and suppresses
+// duplicates, sender retransmits unacknowledged messages while the peer is
+// present.
+//
+// Message is a whisper with frames "ZREL/1", "DATA", epoch, sequence
+// number, the lowest sequence number not acknowledged yet and payload frames,
+// acknowledgement has frames "ZREL/1", "ACK", epoch and sequence number.
+// Epoch is random id of the sending Channel, sequence numbers restart with a
+// new Channel, so receiver resets state of the peer when its epoch changes.
+// Receiver forgets messages below the lowest unacknowledged one, so messages
+// which timed out do not leave gaps. Message is acknowledged after it is
+// recorded by the receiver, so acknowledged message is never lost.
+package reliable
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZREL/1"
+
+const (
+	kindData = "DATA"
+	kindAck  = "ACK"
+)
+
+// DefaultRetryInterval is the time after which unacknowledged message is
+// sent again
+const DefaultRetryInterval = 500 * time.Millisecond
+
+var (
+	// ErrUnknownPeer is returned when sending to peer which is not connected
+	ErrUnknownPeer = errors.New("reliable: unknown peer")
+
+	// ErrPeerExit is reported when peer exits before acknowledgement
+	ErrPeerExit = errors.New("reliable: peer exited")
+
+	// ErrTimeout is reported when message is not acknowledged in time
+	ErrTimeout = errors.New("reliable: delivery timed out")
+
+	// ErrClosed is reported for messages pending when channel is closed
+	ErrClosed = errors.New("reliable: channel closed")
+)
+
+// Sender sends whispers to peers, it is implemented by *zyre.Node
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	PeerAddress(peer string) (string, bool)
+}
+
+// Handler receives messages, each message is passed once
+type Handler func(peer string, data [][]byte)
+
+// Option configures Channel
+type Option func(*Channel)
+
+// RetryInterval sets the time after which unacknowledged message is sent
+// again
+func RetryInterval(d time.Duration) Option {
+	return func(c *Channel) {
+		if d > 0 {
+			c.retry = d
+		}
+	}
+}
+
+// Timeout sets the time after which unacknowledged message fails with
+// ErrTimeout, by default messages are retried until the peer exits
+func Timeout(d time.Duration) Option {
+	return func(c *Channel) {
+		if d > 0 {
+			c.timeout = d
+		}
+	}
+}
+
+// Delivery is a status of sent message
+type Delivery struct {
+	Peer     string
+	Sequence uint64
+
+	done chan struct{}
+	err  error
+}
+
+// Done is closed when message is acknowledged or it failed
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns nil if message was acknowledged by peer, ErrPeerExit,
+// ErrTimeout or ErrClosed if it failed. It blocks until Done is closed.
+func (d *Delivery) Err() error {
+	<-d.done
+	return d.err
+}
+
+// Channel sends and receives acknowledged messages, it is safe for
+// concurrent use
+type Channel struct {
+	sender  Sender
+	handler Handler
+	// epoch identifies sequence numbers of this channel
+	epoch   string
+	retry   time.Duration
+	timeout time.Duration
+
+	mu     sync.Mutex
+	out    map[string]*outPeer
+	in     map[string]*inPeer
+	closed bool
+
+	quit      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// outPeer is sending state of a peer
+type outPeer struct {
+	seq     uint64
+	pending map[uint64]*outgoing
+}
+
+type outgoing struct {
+	data     [][]byte
+	first    time.Time
+	sent     time.Time
+	delivery *Delivery
+}
+
+// inPeer is receiving state of a peer in epoch, messages lower than next
+// were all received, seen are received messages above next
+type inPeer struct {
+	epoch string
+	next  uint64
+	seen  map[uint64]struct{}
+}
+
+// New creates a channel sending by sender (usually *zyre.Node) and passing
+// received messages to handler. Close must be called to stop
+// retransmissions.
+func New(sender Sender, handler Handler, options ...Option) *Channel {
+	b := make([]byte, 8)
+	rand.Read(b)
+	c := &Channel{
+		sender:  sender,
+		handler: handler,
+		epoch:   hex.EncodeToString(b),
+		retry:   DefaultRetryInterval,
+		out:     make(map[string]*outPeer),
+		in:      make(map[string]*inPeer),
+		quit:    make(chan struct{}),
+	}
+	for _, o := range options {
+		o(c)
+	}
+	c.wg.Add(1)
+	go c.retransmit()
+	return c
+}
+
+// Close stops retransmissions, pending deliveries fail with ErrClosed
+func (c *Channel) Close() {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		close(c.quit)
+		c.wg.Wait()
+		c.fail("", ErrClosed)
+	})
+}
+
+// Send sends message to peer, returned Delivery reports the result. Returns
+// ErrClosed after Close.
+func (c *Channel) Send(peer string, data ...[]byte) (*Delivery, error) {
+	select {
+	case <-c.quit:
+		return nil, ErrClosed
+	default:
+	}
+	if _, ok := c.sender.PeerAddress(peer); !ok {
+		return nil, ErrUnknownPeer
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	p, ok := c.out[peer]
+	if !ok {
+		p = &outPeer{pending: make(map[uint64]*outgoing)}
+		c.out[peer] = p
+	}
+	p.seq++
+	now := time.Now()
+	o := &outgoing{
+		data:  copyFrames(data),
+		first: now,
+		sent:  now,
+		delivery: &Delivery{
+			Peer:     peer,
+			Sequence: p.seq,
+			done:     make(chan struct{}),
+		},
+	}
+	p.pending[p.seq] = o
+	message := p.message(c.epoch, p.seq, o)
+	c.mu.Unlock()
+
+	// lost message is sent again by retransmit
+	c.sender.Whisper(peer, message...)
+	return o.delivery, nil
+}
+
+// message returns frames of message seq, caller must hold the lock
+func (p *outPeer) message(epoch string, seq uint64, o *outgoing) [][]byte {
+	low := seq
+	for s := range p.pending {
+		if s < low {
+			low = s
+		}
+	}
+	return append(frames(kindData, epoch, seq, low), o.data...)
+}
+
+// Dispatch handles messages and acknowledgements, it fails deliveries to
+// peers which exited. Returns true if the event was consumed by the
+// channel, other events, including Exit, should be processed by the
+// application.
+func (c *Channel) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		if len(m.Message) < 3 || string(m.Message[0]) != protocol {
+			return false
+		}
+		if len(m.Message) < 4 {
+			return true
+		}
+		epoch := string(m.Message[2])
+		seq, err := strconv.ParseUint(string(m.Message[3]), 10, 64)
+		if err != nil || epoch == "" {
+			return true
+		}
+		switch string(m.Message[1]) {
+		case kindData:
+			if len(m.Message) < 5 {
+				return true
+			}
+			low, err := strconv.ParseUint(string(m.Message[4]), 10, 64)
+			if err != nil || low > seq {
+				return true
+			}
+			// duplicate is acknowledged too, its acknowledgement was lost
+			fresh := c.receive(m.Peer, epoch, seq, low)
+			c.sender.Whisper(m.Peer, frames(kindAck, epoch, seq)...)
+			if fresh && c.handler != nil {
+				c.handler(m.Peer, m.Message[5:])
+			}
+		case kindAck:
+			if epoch == c.epoch {
+				c.ack(m.Peer, seq)
+			}
+		}
+		return true
+	case zyre.Exit:
+		c.fail(m.Peer, ErrPeerExit)
+		c.mu.Lock()
+		delete(c.in, m.Peer)
+		c.mu.Unlock()
+	case zyre.Stop:
+		c.fail("", ErrPeerExit)
+		c.mu.Lock()
+		c.in = make(map[string]*inPeer)
+		c.mu.Unlock()
+	}
+	return false
+}
+
+// receive records message, returns false for duplicates. Messages below
+// low were acknowledged or abandoned by sender, they are forgotten. State of
+// the peer starts again when its epoch changes.
+func (c *Channel) receive(peer, epoch string, seq, low uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.in[peer]
+	if !ok || p.epoch != epoch {
+		p = &inPeer{epoch: epoch, next: 1, seen: make(map[uint64]struct{})}
+		c.in[peer] = p
+	}
+	if low > p.next {
+		for s := range p.seen {
+			if s < low {
+				delete(p.seen, s)
+			}
+		}
+		p.next = low
+	}
+	if _, dup := p.seen[seq]; dup || seq < p.next {
+		return false
+	}
+	p.seen[seq] = struct{}{}
+	for {
+		if _, ok := p.seen[p.next]; !ok {
+			break
+		}
+		delete(p.seen, p.next)
+		p.next++
+	}
+	return true
+}
+
+func (c *Channel) ack(peer string, seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.out[peer]
+	if !ok {
+		return
+	}
+	if o, ok := p.pending[seq]; ok {
+		delete(p.pending, seq)
+		close(o.delivery.done)
+	}
+}
+
+// fail fails pending deliveries to peer, or to all peers if peer is empty
+func (c *Channel) fail(peer string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uuid, p := range c.out {
+		if peer != "" && uuid != peer {
+			continue
+		}
+		for _, o := range p.pending {
+			o.delivery.err = err
+			close(o.delivery.done)
+		}
+		delete(c.out, uuid)
+	}
+}
+
+// retransmit sends unacknowledged messages again
+func (c *Channel) retransmit() {
+	defer c.wg.Done()
+	tick := c.retry / 2
+	if tick <= 0 {
+		tick = c.retry
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.quit:
+			return
+		case now := <-ticker.C:
+			type resend struct {
+				peer   string
+				frames [][]byte
+			}
+			var due []resend
+			c.mu.Lock()
+			for peer, p := range c.out {
+				for seq, o := range p.pending {
+					if c.timeout > 0 && now.Sub(o.first) >= c.timeout {
+						delete(p.pending, seq)
+						o.delivery.err = ErrTimeout
+						close(o.delivery.done)
+						continue
+					}
+					if now.Sub(o.sent) >= c.retry {
+						o.sent = now
+						due = append(due, resend{peer, p.message(c.epoch, seq, o)})
+					}
+				}
+			}
+			c.mu.Unlock()
+			for _, r := range due {
+				c.sender.Whisper(r.peer, r.frames...)
+			}
+		}
+	}
+}
+
+func frames(kind, epoch string, seqs ...uint64) [][]byte {
+	f := [][]byte{[]byte(protocol), []byte(kind), []byte(epoch)}
+	for _, seq := range seqs {
+		f = append(f, []byte(strconv.FormatUint(seq, 10)))
+	}
+	return f
+}
+
+func copyFrames(data [][]byte) [][]byte {
+	c := make([][]byte, len(data))
+	for i, d := range data {
+		c[i] = append([]byte{}, d...)
+	}
+	return c
+}
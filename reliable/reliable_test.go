@@ -0,0 +1,260 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package reliable
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+	"github.com/zeromq/gozyre/internal/testpeer"
+)
+
+// link is a node which drops whispers selected by drop, it injects lost
+// messages and disconnected peers
+type link struct {
+	*zyre.Node
+	mu    sync.Mutex
+	count int
+	drop  func(n int, data [][]byte) bool
+}
+
+func (l *link) Whisper(peer string, data ...[]byte) error {
+	l.mu.Lock()
+	l.count++
+	drop := l.drop != nil && l.drop(l.count, data)
+	l.mu.Unlock()
+	if drop {
+		return nil
+	}
+	return l.Node.Whisper(peer, data...)
+}
+
+func (l *link) setDrop(drop func(n int, data [][]byte) bool) {
+	l.mu.Lock()
+	l.drop = drop
+	l.mu.Unlock()
+}
+
+// peer is a node with reliable channel fed by its events
+type peer struct {
+	*testpeer.Peer
+	link     *link
+	received chan string
+
+	mu      sync.Mutex
+	channel *Channel
+}
+
+func newPeer(t *testing.T, name string, options ...Option) *peer {
+	p := &peer{
+		Peer:     testpeer.New(t, name, 5682),
+		received: make(chan string, 256),
+	}
+	p.link = &link{Node: p.Node}
+	p.restart(options...)
+	p.Start(t, func(e zyre.Event) bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.channel.Dispatch(e)
+	})
+	return p
+}
+
+// restart replaces channel of the peer by a new one
+func (p *peer) restart(options ...Option) {
+	channel := New(p.link, func(peer string, data [][]byte) {
+		p.received <- string(data[0])
+	}, options...)
+	p.mu.Lock()
+	old := p.channel
+	p.channel = channel
+	p.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (p *peer) close() {
+	p.mu.Lock()
+	p.channel.Close()
+	p.mu.Unlock()
+	p.Close()
+}
+
+func wait(t *testing.T, d *Delivery) error {
+	select {
+	case <-d.Done():
+		return d.Err()
+	case <-time.After(10 * time.Second):
+		t.Fatalf("delivery %d not finished", d.Sequence)
+		return nil
+	}
+}
+
+func TestReliable(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sender := newPeer(t, "sender", RetryInterval(50*time.Millisecond))
+	defer sender.close()
+	receiver := newPeer(t, "receiver", RetryInterval(50*time.Millisecond))
+	defer receiver.close()
+	sender.WaitEnter(t, receiver.link.UUID())
+
+	// every other message and acknowledgement is lost
+	lossy := func(n int, data [][]byte) bool { return n%2 == 1 }
+	sender.link.setDrop(lossy)
+	receiver.link.setDrop(lossy)
+
+	const count = 20
+	var deliveries []*Delivery
+	for i := 0; i != count; i++ {
+		d, err := sender.channel.Send(receiver.link.UUID(), []byte(fmt.Sprintf("msg-%d", i)))
+		assert.NoError(err)
+		assert.Equal(uint64(i+1), d.Sequence)
+		deliveries = append(deliveries, d)
+	}
+	for _, d := range deliveries {
+		assert.NoError(wait(t, d))
+	}
+
+	// each message is received once despite retransmissions
+	seen := make(map[string]int)
+	for len(seen) != count {
+		select {
+		case m := <-receiver.received:
+			seen[m]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d messages", len(seen), count)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	for len(receiver.received) != 0 {
+		seen[<-receiver.received]++
+	}
+	for i := 0; i != count; i++ {
+		assert.Equal(1, seen[fmt.Sprintf("msg-%d", i)])
+	}
+
+	_, err := sender.channel.Send("NO-SUCH-PEER", []byte("x"))
+	assert.Equal(ErrUnknownPeer, err)
+}
+
+func TestReliableRestart(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sender := newPeer(t, "sender", RetryInterval(50*time.Millisecond))
+	defer sender.close()
+	receiver := newPeer(t, "receiver")
+	defer receiver.close()
+	sender.WaitEnter(t, receiver.link.UUID())
+
+	send := func(msg string) {
+		d, err := sender.channel.Send(receiver.link.UUID(), []byte(msg))
+		assert.NoError(err)
+		assert.NoError(wait(t, d))
+		select {
+		case m := <-receiver.received:
+			assert.Equal(msg, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received", msg)
+		}
+	}
+	send("first-1")
+	send("first-2")
+
+	// new channel numbers messages from 1 again, they are not duplicates
+	sender.restart(RetryInterval(50 * time.Millisecond))
+	send("second-1")
+	send("second-2")
+	send("second-3")
+}
+
+func TestReliablePeerExit(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sender := newPeer(t, "sender", RetryInterval(50*time.Millisecond))
+	defer sender.close()
+	receiver := newPeer(t, "receiver")
+	sender.WaitEnter(t, receiver.link.UUID())
+
+	// peer is disconnected, nothing reaches it
+	sender.link.setDrop(func(n int, data [][]byte) bool { return true })
+	d, err := sender.channel.Send(receiver.link.UUID(), []byte("lost"))
+	assert.NoError(err)
+	select {
+	case <-d.Done():
+		t.Fatal("delivery finished while peer is present")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	receiver.close()
+	assert.Equal(ErrPeerExit, wait(t, d))
+}
+
+func TestReliableTimeout(t *testing.T) {
+
+	assert := assert.New(t)
+
+	sender := newPeer(t, "sender", RetryInterval(50*time.Millisecond), Timeout(300*time.Millisecond))
+	defer sender.close()
+	receiver := newPeer(t, "receiver")
+	defer receiver.close()
+	sender.WaitEnter(t, receiver.link.UUID())
+
+	sender.link.setDrop(func(n int, data [][]byte) bool { return true })
+	d, err := sender.channel.Send(receiver.link.UUID(), []byte("lost"))
+	assert.NoError(err)
+	assert.Equal(ErrTimeout, wait(t, d))
+
+	sender.link.setDrop(nil)
+	d, err = sender.channel.Send(receiver.link.UUID(), []byte("delivered"))
+	assert.NoError(err)
+	assert.NoError(wait(t, d))
+	assert.Equal("delivered", <-receiver.received)
+
+	// timed out message does not stay as a gap at receiver
+	receiver.channel.mu.Lock()
+	in := receiver.channel.in[sender.link.UUID()]
+	assert.Equal(uint64(3), in.next)
+	assert.Empty(in.seen)
+	receiver.channel.mu.Unlock()
+}
+
+func TestReliableClose(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node, err := zyre.New("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Destroy()
+
+	// invalid intervals are ignored, they must not stop retransmissions
+	for _, d := range []time.Duration{0, 1, -time.Second} {
+		c := New(node, nil, RetryInterval(d), Timeout(d))
+		c.Close()
+	}
+
+	c := New(node, nil)
+	var wg sync.WaitGroup
+	for i := 0; i != 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+	_, err = c.Send(node.UUID(), []byte("x"))
+	assert.Equal(ErrClosed, err)
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+// Client calls methods of servers running on peers
+type Client struct {
+	node *zyre.Node
+	// prefix of request ids, random so ids of clients sharing a node or
+	// a server do not collide
+	prefix string
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[string]*call
+	gathers map[string]*gather
+}
+
+type call struct {
+	peer   string
+	method string
+	reply  chan Reply
+}
+
+// Reply is a reply of one peer to Gather
+type Reply struct {
+	Payload []byte
+	Err     error
+}
+
+// NewClient creates a client sending requests by node
+func NewClient(node *zyre.Node) *Client {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Client{
+		node:    node,
+		prefix:  hex.EncodeToString(b) + "-",
+		pending: make(map[string]*call),
+		gathers: make(map[string]*gather),
+	}
+}
+
+// nextID returns id of new request, caller must hold the lock
+func (c *Client) nextID() string {
+	c.seq++
+	return c.prefix + strconv.FormatUint(c.seq, 10)
+}
+
+// Call calls method of peer and waits for reply. It returns payload of
+// reply, *RemoteError if server returned error, ErrPeerExit if the peer
+// exited or ctx.Err() if ctx is done before reply. Server is notified when
+// the call is abandoned.
+func (c *Client) Call(ctx context.Context, peer string, method string, payload []byte) ([]byte, error) {
+	if _, ok := c.node.PeerAddress(peer); !ok {
+		return nil, ErrUnknownPeer
+	}
+
+	cl := &call{
+		peer:   peer,
+		method: method,
+		reply:  make(chan Reply, 1),
+	}
+	c.mu.Lock()
+	id := c.nextID()
+	c.pending[id] = cl
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	err := c.node.Whisper(peer, frames(kindRequest, id, []byte(method), payload)...)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-cl.reply:
+		return r.Payload, r.Err
+	case <-ctx.Done():
+		c.node.Whisper(peer, frames(kindCancel, id)...)
+		return nil, ctx.Err()
+	}
+}
+
+// Dispatch passes replies to pending calls and fails calls to peers which
+// exited. Returns true if the event was a reply to a pending call or
+// gather of the client, other events, including Exit and late replies of
+// abandoned calls, should be processed by the application.
+func (c *Client) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		kind, id, rest, ok := parse(m.Message)
+		if !ok || (kind != kindOK && kind != kindError) {
+			return false
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if cl, ok := c.pending[id]; ok && cl.peer == m.Peer {
+			delete(c.pending, id)
+			cl.reply <- reply(cl.method, kind, rest)
+			return true
+		}
+		if g, ok := c.gathers[id]; ok {
+			g.answer(m.Peer, reply(g.method, kind, rest))
+			return true
+		}
+		return false
+	case zyre.Evasive:
+		c.mu.Lock()
+		for _, g := range c.gathers {
+			g.answer(m.Peer, Reply{Err: ErrPeerEvasive})
+		}
+		c.mu.Unlock()
+	case zyre.Exit:
+		c.fail(m.Peer, ErrPeerExit)
+	case zyre.Stop:
+		c.fail("", ErrStopped)
+	}
+	return false
+}
+
+// reply converts frames of reply
+func reply(method, kind string, rest [][]byte) (r Reply) {
+	if kind == kindOK {
+		if len(rest) > 0 {
+			r.Payload = rest[0]
+		}
+		return
+	}
+	rerr := &RemoteError{Method: method}
+	if len(rest) > 1 {
+		rerr.Code, rerr.Message = string(rest[0]), string(rest[1])
+	}
+	r.Err = rerr
+	return
+}
+
+// fail fails pending calls to peer, or all calls if peer is empty
+func (c *Client) fail(peer string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cl := range c.pending {
+		if peer == "" || cl.peer == peer {
+			delete(c.pending, id)
+			cl.reply <- Reply{Err: err}
+		}
+	}
+	for _, g := range c.gathers {
+		for p := range g.expected {
+			if peer == "" || p == peer {
+				g.answer(p, Reply{Err: err})
+			}
+		}
+	}
+}
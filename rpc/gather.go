@@ -0,0 +1,84 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+)
+
+// gather collects replies of group members
+type gather struct {
+	method   string
+	expected map[string]struct{}
+	replies  map[string]Reply
+	done     chan struct{}
+}
+
+// answer records reply of peer, caller must hold the lock of client.
+// Evasive peer may still reply, so ErrPeerEvasive can be replaced.
+func (g *gather) answer(peer string, r Reply) {
+	if _, ok := g.expected[peer]; !ok {
+		return
+	}
+	if prev, ok := g.replies[peer]; ok && prev.Err != ErrPeerEvasive {
+		return
+	}
+	g.replies[peer] = r
+	if len(g.replies) == len(g.expected) {
+		select {
+		case <-g.done:
+		default:
+			close(g.done)
+		}
+	}
+}
+
+// Gather calls method of all members of group returned by PeersByGroup and
+// returns their replies by UUID of peer, once every member answered or ctx
+// is done. Reply.Err is *RemoteError if server returned error,
+// ErrPeerExit or ErrPeerEvasive if the peer exited or went evasive and
+// ctx.Err() if the peer did not answer in time. Request is sent by a single
+// Shout, error is returned only if it fails.
+func (c *Client) Gather(ctx context.Context, group string, method string, payload []byte) (map[string]Reply, error) {
+	g := &gather{
+		method:   method,
+		expected: make(map[string]struct{}),
+		replies:  make(map[string]Reply),
+		done:     make(chan struct{}),
+	}
+	for _, peer := range c.node.PeersByGroup(group) {
+		g.expected[peer] = struct{}{}
+	}
+	if len(g.expected) == 0 {
+		return g.replies, nil
+	}
+
+	c.mu.Lock()
+	id := c.nextID()
+	c.gathers[id] = g
+	c.mu.Unlock()
+
+	err := c.node.Shout(group, frames(kindRequest, id, []byte(method), payload)...)
+	if err == nil {
+		select {
+		case <-g.done:
+		case <-ctx.Done():
+			c.node.Shout(group, frames(kindCancel, id)...)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.gathers, id)
+	if err != nil {
+		return nil, err
+	}
+	for peer := range g.expected {
+		if _, ok := g.replies[peer]; !ok {
+			g.replies[peer] = Reply{Err: ctx.Err()}
+		}
+	}
+	return g.replies, nil
+}
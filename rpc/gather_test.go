@@ -0,0 +1,85 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGather(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client := newPeer(t, "client")
+	defer client.Close()
+	workers := make([]*peer, 4)
+	for i, name := range []string{"w1", "w2", "w3", "w4"} {
+		workers[i] = newPeer(t, name)
+		assert.NoError(workers[i].Node.Join("WORKERS"))
+	}
+	for _, w := range workers[:3] {
+		defer w.Close()
+	}
+
+	// w1 and w2 answer, w3 has no handler, w4 blocks and exits mid-flight
+	name := func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		return append(payload, ":name"...), nil
+	}
+	workers[0].server.Handle("name", name)
+	workers[1].server.Handle("name", name)
+	blocked := make(chan struct{})
+	workers[3].server.Handle("name", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		close(blocked)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	go func() {
+		<-blocked
+		workers[3].Close()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(client.Node.PeersByGroup("WORKERS")) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("workers did not join")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	replies, err := client.client.Gather(ctx, "WORKERS", "name", []byte("q"))
+	assert.NoError(err)
+	assert.Len(replies, 4)
+	for _, w := range workers[:2] {
+		r := replies[w.Node.UUID()]
+		assert.NoError(r.Err)
+		assert.Equal([]byte("q:name"), r.Payload)
+	}
+	assert.True(errors.Is(replies[workers[2].Node.UUID()].Err, ErrUnknownMethod))
+	assert.Equal(ErrPeerExit, replies[workers[3].UUID].Err)
+
+	// deadline fires before slow member answers
+	workers[1].server.Handle("name", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	tctx, tcancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer tcancel()
+	replies, err = client.client.Gather(tctx, "WORKERS", "name", nil)
+	assert.NoError(err)
+	assert.Len(replies, 3)
+	assert.NoError(replies[workers[0].Node.UUID()].Err)
+	assert.Equal(context.DeadlineExceeded, replies[workers[1].Node.UUID()].Err)
+
+	replies, err = client.client.Gather(ctx, "NOBODY", "name", nil)
+	assert.NoError(err)
+	assert.Empty(replies)
+}
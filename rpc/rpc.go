@@ -0,0 +1,91 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package rpc implements request/reply calls between zyre peers on top of
+// Whisper.
+//
+// Client and Server do not receive events themselves, the application
+// passes events it receives from the node to their Dispatch methods:
+//
+//	for e := range events {
+//		if client.Dispatch(e) || server.Dispatch(e) {
+//			continue
+//		}
+//		...
+//	}
+//
+// Request is a whisper with frames "ZRPC/1", "REQ", id, method and payload,
+// Gather sends the same frames by shout to a group. Reply has frames
+// "ZRPC/1", "OK", id and payload, or "ZRPC/1", "ERR", id, code and message.
+// Client sends "ZRPC/1", "CANCEL", id when the call is abandoned.
+package rpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+const protocol = "ZRPC/1"
+
+// kinds of messages
+const (
+	kindRequest = "REQ"
+	kindOK      = "OK"
+	kindError   = "ERR"
+	kindCancel  = "CANCEL"
+)
+
+// codes of errors sent to clients
+const (
+	codeUnknownMethod = "UNKNOWN_METHOD"
+	codeHandler       = "HANDLER"
+	codePanic         = "PANIC"
+)
+
+var (
+	// ErrUnknownPeer is returned when calling peer which is not connected
+	ErrUnknownPeer = errors.New("rpc: unknown peer")
+
+	// ErrPeerExit is returned when peer exits before reply
+	ErrPeerExit = errors.New("rpc: peer exited")
+
+	// ErrStopped is returned when node stops before reply
+	ErrStopped = errors.New("rpc: node stopped")
+
+	// ErrPeerEvasive is reported by Gather for peer which became evasive
+	// before reply
+	ErrPeerEvasive = errors.New("rpc: peer is evasive")
+
+	// ErrUnknownMethod is matched by RemoteError for methods without handler
+	ErrUnknownMethod = errors.New("rpc: unknown method")
+)
+
+// RemoteError is an error returned by the server
+type RemoteError struct {
+	Method  string
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("rpc: %s: %s", e.Method, e.Message)
+}
+
+// Is makes errors.Is(err, ErrUnknownMethod) work
+func (e *RemoteError) Is(target error) bool {
+	return target == ErrUnknownMethod && e.Code == codeUnknownMethod
+}
+
+// parse returns kind, id and remaining frames of rpc message, ok is false
+// for other messages
+func parse(message [][]byte) (kind string, id string, rest [][]byte, ok bool) {
+	if len(message) < 3 || string(message[0]) != protocol {
+		return
+	}
+	return string(message[1]), string(message[2]), message[3:], true
+}
+
+func frames(kind, id string, rest ...[]byte) [][]byte {
+	return append([][]byte{[]byte(protocol), []byte(kind), []byte(id)}, rest...)
+}
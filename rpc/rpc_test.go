@@ -0,0 +1,160 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	zyre "github.com/zeromq/gozyre"
+	"github.com/zeromq/gozyre/internal/testpeer"
+)
+
+// peer is a node with rpc client and server fed by its events
+type peer struct {
+	*testpeer.Peer
+	client *Client
+	server *Server
+}
+
+func newPeer(t *testing.T, name string) *peer {
+	p := &peer{Peer: testpeer.New(t, name, 5679)}
+	p.client = NewClient(p.Node)
+	p.server = NewServer(p.Node)
+	p.Start(t, func(e zyre.Event) bool {
+		return p.client.Dispatch(e) || p.server.Dispatch(e)
+	})
+	return p
+}
+
+func TestRPC(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client := newPeer(t, "client")
+	defer client.Close()
+	server := newPeer(t, "server")
+	defer server.Close()
+	client.WaitEnter(t, server.Node.UUID())
+
+	server.server.Handle("upper", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		assert.Equal(client.Node.UUID(), peer)
+		return []byte(strings.ToUpper(string(payload))), nil
+	})
+	server.server.Handle("fail", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		return nil, errors.New("failed")
+	})
+	server.server.Handle("panic", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		panic("boom")
+	})
+	cancelled := make(chan struct{})
+	server.server.Handle("block", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	uuid := server.Node.UUID()
+
+	reply, err := client.client.Call(ctx, uuid, "upper", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal([]byte("HELLO"), reply)
+
+	// empty payload and reply
+	reply, err = client.client.Call(ctx, uuid, "upper", nil)
+	assert.NoError(err)
+	assert.Empty(reply)
+
+	_, err = client.client.Call(ctx, uuid, "fail", nil)
+	var rerr *RemoteError
+	assert.True(errors.As(err, &rerr))
+	assert.Equal("fail", rerr.Method)
+	assert.Equal("failed", rerr.Message)
+	assert.Equal("rpc: fail: failed", err.Error())
+
+	_, err = client.client.Call(ctx, uuid, "panic", nil)
+	assert.True(errors.As(err, &rerr))
+	assert.Equal("panic: boom", rerr.Message)
+
+	_, err = client.client.Call(ctx, uuid, "missing", nil)
+	assert.True(errors.Is(err, ErrUnknownMethod), "%v", err)
+
+	_, err = client.client.Call(ctx, "NO-SUCH-PEER", "upper", nil)
+	assert.Equal(ErrUnknownPeer, err)
+
+	// timeout of call cancels the handler
+	tctx, tcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = client.client.Call(tctx, uuid, "block", nil)
+	tcancel()
+	assert.Equal(context.DeadlineExceeded, err)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("handler was not cancelled")
+	}
+}
+
+func TestRPCPeerExit(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client := newPeer(t, "client")
+	defer client.Close()
+	server := newPeer(t, "server")
+	client.WaitEnter(t, server.Node.UUID())
+
+	started := make(chan struct{})
+	server.server.Handle("block", func(ctx context.Context, peer string, payload []byte) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	go func() {
+		<-started
+		server.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := client.client.Call(ctx, server.Node.UUID(), "block", nil)
+	assert.Equal(ErrPeerExit, err)
+}
+
+func TestClientDispatch(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node, err := zyre.New("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Destroy()
+
+	// clients sharing a node do not reuse ids and do not take replies of
+	// each other
+	c1, c2 := NewClient(node), NewClient(node)
+	c1.mu.Lock()
+	id := c1.nextID()
+	c1.mu.Unlock()
+	c2.mu.Lock()
+	assert.NotEqual(id, c2.nextID())
+	c2.mu.Unlock()
+
+	cl := &call{peer: "PEER", method: "upper", reply: make(chan Reply, 1)}
+	c1.pending[id] = cl
+	r := zyre.Whisper{Peer: "PEER", Message: frames(kindOK, id, []byte("HELLO"))}
+	assert.False(c2.Dispatch(r))
+	assert.True(c1.Dispatch(r))
+	assert.Equal([]byte("HELLO"), (<-cl.reply).Payload)
+
+	// late reply of abandoned call is left to the application
+	assert.False(c1.Dispatch(r))
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+// Handler handles a request from peer. The context is cancelled when the
+// client abandons the call, the peer exits or the node stops. Returned
+// error is sent to the client as RemoteError.
+type Handler func(ctx context.Context, peer string, payload []byte) ([]byte, error)
+
+// Server serves requests of peers, each request is handled in its own
+// goroutine
+type Server struct {
+	node *zyre.Node
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	// cancel functions of running requests by peer and id
+	running map[string]map[string]context.CancelFunc
+}
+
+// NewServer creates a server replying by node
+func NewServer(node *zyre.Node) *Server {
+	return &Server{
+		node:     node,
+		handlers: make(map[string]Handler),
+		running:  make(map[string]map[string]context.CancelFunc),
+	}
+}
+
+// Handle registers handler of method, nil handler removes it
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h == nil {
+		delete(s.handlers, method)
+		return
+	}
+	s.handlers[method] = h
+}
+
+// Dispatch starts handlers of requests sent by Call or Gather and cancels
+// them when clients abandon calls or peers exit. Returns true if the event
+// was a request consumed by the server, other events, including Exit, should
+// be processed by the application.
+func (s *Server) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		return s.request(m.Peer, m.Message)
+	case zyre.Shout:
+		return s.request(m.Peer, m.Message)
+	case zyre.Exit:
+		s.cancel(m.Peer, "")
+	case zyre.Stop:
+		s.mu.Lock()
+		peers := make([]string, 0, len(s.running))
+		for peer := range s.running {
+			peers = append(peers, peer)
+		}
+		s.mu.Unlock()
+		for _, peer := range peers {
+			s.cancel(peer, "")
+		}
+	}
+	return false
+}
+
+// request handles request or cancel sent by whisper or shout
+func (s *Server) request(peer string, message [][]byte) bool {
+	kind, id, rest, ok := parse(message)
+	switch {
+	case !ok:
+		return false
+	case kind == kindRequest && len(rest) > 0:
+		var payload []byte
+		if len(rest) > 1 {
+			payload = rest[1]
+		}
+		s.start(peer, id, string(rest[0]), payload)
+		return true
+	case kind == kindCancel:
+		s.cancel(peer, id)
+		return true
+	}
+	return false
+}
+
+func (s *Server) start(peer, id, method string, payload []byte) {
+	s.mu.Lock()
+	h, ok := s.handlers[method]
+	if !ok {
+		s.mu.Unlock()
+		s.node.Whisper(peer, frames(kindError, id,
+			[]byte(codeUnknownMethod), []byte(fmt.Sprintf("unknown method %q", method)))...)
+		return
+	}
+	if _, ok := s.running[peer][id]; ok {
+		// duplicate request, reply to the first one answers it
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if s.running[peer] == nil {
+		s.running[peer] = make(map[string]context.CancelFunc)
+	}
+	s.running[peer][id] = cancel
+	s.mu.Unlock()
+
+	go func() {
+		defer s.done(peer, id)
+		reply, code, err := safeCall(ctx, h, peer, payload)
+		if ctx.Err() != nil {
+			// nobody waits for the reply
+			return
+		}
+		if err != nil {
+			s.node.Whisper(peer, frames(kindError, id, []byte(code), []byte(err.Error()))...)
+			return
+		}
+		s.node.Whisper(peer, frames(kindOK, id, reply)...)
+	}()
+}
+
+// safeCall calls handler and converts panic to error
+func safeCall(ctx context.Context, h Handler, peer string, payload []byte) (reply []byte, code string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			code, err = codePanic, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	reply, err = h(ctx, peer, payload)
+	if err != nil {
+		code = codeHandler
+	}
+	return
+}
+
+// cancel cancels request of peer, or all its requests if id is empty
+func (s *Server) cancel(peer, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, cancel := range s.running[peer] {
+		if id == "" || i == id {
+			cancel()
+		}
+	}
+}
+
+func (s *Server) done(peer, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.running[peer][id]; ok {
+		cancel()
+		delete(s.running[peer], id)
+		if len(s.running[peer]) == 0 {
+			delete(s.running, peer)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zyre
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a semantic version (https://semver.org), build metadata is
+// ignored
+type version struct {
+	major, minor, patch uint64
+	pre                 []string
+}
+
+// parseVersion parses version, leading "v" and missing minor or patch
+// numbers are accepted, so "v1.2" is 1.2.0
+func parseVersion(s string) (v version, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		err = fmt.Errorf("invalid version %q", s)
+		return
+	}
+	nums := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		*nums[i], err = strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid version %q", s)
+			return
+		}
+	}
+	return
+}
+
+// compare returns -1, 0 or 1 if v is less, equal or greater than w
+func (v version) compare(w version) int {
+	for _, d := range [][2]uint64{{v.major, w.major}, {v.minor, w.minor}, {v.patch, w.patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// version without pre-release has higher precedence
+	switch {
+	case len(v.pre) == 0 && len(w.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(w.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		if c := comparePre(v.pre[i], w.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(w.pre):
+		return -1
+	case len(v.pre) > len(w.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePre compares pre-release identifiers, numeric ones are lower than
+// alphanumeric
+func comparePre(a, b string) int {
+	na, erra := strconv.ParseUint(a, 10, 64)
+	nb, errb := strconv.ParseUint(b, 10, 64)
+	switch {
+	case erra == nil && errb == nil:
+		if na == nb {
+			return 0
+		}
+		if na < nb {
+			return -1
+		}
+		return 1
+	case erra == nil:
+		return -1
+	case errb == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// lowestPre is the lowest pre-release, upper bounds of ^ and ~ use it, so
+// pre-releases of the next version do not match
+var lowestPre = []string{"0"}
+
+// comparator is a single condition of version range, eg. ">=1.2.0"
+type comparator struct {
+	op string
+	v  version
+}
+
+func (c comparator) match(v version) bool {
+	r := v.compare(c.v)
+	switch c.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	}
+	return false
+}
+
+// versionRange is a set of comparators joined by AND in alternatives joined
+// by OR
+type versionRange [][]comparator
+
+// parseRange parses version range like ">=1.2.0 <2.0.0 || ^3.1". Supported
+// operators are =, !=, >, >=, <, <=, ^ (compatible with: same major, same
+// minor for 0.x, or the same version for 0.0.x) and ~ (same minor).
+// Comparators are separated by spaces or commas.
+func parseRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.FieldsFunc(alt, func(c rune) bool { return c == ' ' || c == ',' })
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid version range %q", s)
+		}
+		var and []comparator
+		for _, f := range fields {
+			cs, err := parseComparator(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version range %q: %v", s, err)
+			}
+			and = append(and, cs...)
+		}
+		r = append(r, and)
+	}
+	return r, nil
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+	v, err := parseVersion(s[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "", "=":
+		return []comparator{{"=", v}}, nil
+	case "^":
+		// the first non-zero number must not change, numbers which are
+		// not written may change, so ^0 is <1.0.0 and ^0.0 is <0.1.0
+		core := s[len(op):]
+		if i := strings.IndexAny(core, "-+"); i >= 0 {
+			core = core[:i]
+		}
+		parts := strings.Count(core, ".") + 1
+		upper := version{major: v.major + 1, pre: lowestPre}
+		switch {
+		case v.major > 0 || parts == 1:
+		case v.minor > 0 || parts == 2:
+			upper = version{minor: v.minor + 1, pre: lowestPre}
+		default:
+			upper = version{patch: v.patch + 1, pre: lowestPre}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "~":
+		upper := version{major: v.major, minor: v.minor + 1, pre: lowestPre}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	}
+	return []comparator{{op, v}}, nil
+}
+
+// match reports whether v is in range. Pre-release version matches only
+// alternative with a comparator naming pre-release of the same version, as
+// in npm, so 1.3.0-rc.1 matches ">=1.3.0-rc.0" but not ">=1.2.0 <2.0.0".
+func (r versionRange) match(v version) bool {
+	for _, and := range r {
+		ok := len(v.pre) == 0
+		for _, c := range and {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+			if len(c.v.pre) > 0 && c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+				ok = true
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
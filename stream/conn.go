@@ -0,0 +1,330 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Conn is a connection to peer, it implements net.Conn
+type Conn struct {
+	t    *Transport
+	peer string
+	role string
+	id   string
+	key  string
+
+	// accepted receives the result of Dial
+	accepted chan error
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	consumed int   // read bytes not reported by WIN
+	window   int   // bytes which can be sent, set by the peer
+	rerr     error // returned by Read when buf is empty
+	werr     error // returned by Write
+	closed   bool
+
+	// readable and writable are closed and replaced when the state of
+	// reading or writing changes, so all blocked Reads or Writes wake up
+	readable chan struct{}
+	writable chan struct{}
+
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+func (t *Transport) newConn(peer, role, id string) *Conn {
+	return &Conn{
+		t:             t,
+		peer:          peer,
+		role:          role,
+		id:            id,
+		key:           key(peer, role, id),
+		readable:      make(chan struct{}),
+		writable:      make(chan struct{}),
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+	}
+}
+
+func (c *Conn) send(kind string, args ...[]byte) error {
+	frames := append([][]byte{[]byte(protocol), []byte(kind), []byte(c.role), []byte(c.id)}, args...)
+	return c.t.sender.Whisper(c.peer, frames...)
+}
+
+// broadcast wakes up all waiting for ch, caller must hold the lock
+func broadcast(ch *chan struct{}) {
+	close(*ch)
+	*ch = make(chan struct{})
+}
+
+// Read reads data sent by the peer. It returns io.EOF after the peer closed
+// the connection or its writing side.
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if isClosed(c.readDeadline.wait()) {
+			c.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		if c.buf.Len() > 0 {
+			n, _ := c.buf.Read(b)
+			c.consumed += n
+			var win int
+			if c.consumed >= c.t.window/2 && c.rerr == nil {
+				win, c.consumed = c.consumed, 0
+			}
+			c.mu.Unlock()
+			if win > 0 {
+				c.send(kindWin, []byte(strconv.Itoa(win)))
+			}
+			return n, nil
+		}
+		if c.rerr != nil {
+			err := c.rerr
+			c.mu.Unlock()
+			return 0, err
+		}
+		readable := c.readable
+		c.mu.Unlock()
+		if len(b) == 0 {
+			return 0, nil
+		}
+		select {
+		case <-readable:
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Write sends data to the peer, it blocks while the peer did not read
+// Window bytes sent before
+func (c *Conn) Write(b []byte) (int, error) {
+	n := 0
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return n, net.ErrClosed
+		}
+		if c.werr != nil {
+			err := c.werr
+			c.mu.Unlock()
+			return n, err
+		}
+		if isClosed(c.writeDeadline.wait()) {
+			c.mu.Unlock()
+			return n, os.ErrDeadlineExceeded
+		}
+		if len(b) == 0 {
+			c.mu.Unlock()
+			return n, nil
+		}
+		if c.window == 0 {
+			writable := c.writable
+			c.mu.Unlock()
+			select {
+			case <-writable:
+			case <-c.writeDeadline.wait():
+				return n, os.ErrDeadlineExceeded
+			}
+			continue
+		}
+		k := len(b)
+		if k > c.window {
+			k = c.window
+		}
+		if k > maxFrame {
+			k = maxFrame
+		}
+		c.window -= k
+		c.mu.Unlock()
+		if err := c.send(kindData, b[:k]); err != nil {
+			return n, err
+		}
+		n += k
+		b = b[k:]
+	}
+}
+
+func (c *Conn) receive(data []byte) {
+	c.mu.Lock()
+	if c.rerr == nil && !c.closed {
+		c.buf.Write(data)
+	}
+	broadcast(&c.readable)
+	c.mu.Unlock()
+}
+
+func (c *Conn) credit(n int) {
+	c.mu.Lock()
+	c.window += n
+	broadcast(&c.writable)
+	c.mu.Unlock()
+}
+
+func (c *Conn) fin() {
+	c.mu.Lock()
+	if c.rerr == nil {
+		c.rerr = io.EOF
+	}
+	broadcast(&c.readable)
+	c.mu.Unlock()
+}
+
+// reset fails the connection with err, reads return buffered data first
+func (c *Conn) reset(err error) {
+	c.mu.Lock()
+	if c.rerr == nil {
+		c.rerr = err
+	}
+	if c.werr == nil || c.werr == net.ErrClosed {
+		c.werr = err
+	}
+	broadcast(&c.readable)
+	broadcast(&c.writable)
+	c.mu.Unlock()
+}
+
+// CloseWrite shuts down the writing side, the peer reads io.EOF after data
+// written before
+func (c *Conn) CloseWrite() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	if c.werr != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.werr = net.ErrClosed
+	broadcast(&c.writable)
+	c.mu.Unlock()
+	return c.send(kindFin)
+}
+
+// Close closes the connection, the peer reads io.EOF after data written
+// before and its writes fail with ErrReset
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	open := c.werr == nil
+	reset := c.werr == nil || c.werr == net.ErrClosed
+	c.werr = net.ErrClosed
+	broadcast(&c.readable)
+	broadcast(&c.writable)
+	c.mu.Unlock()
+	c.t.remove(c)
+	if open {
+		c.send(kindFin)
+	}
+	if reset {
+		c.send(kindRst)
+	}
+	return nil
+}
+
+// LocalAddr returns address of the node
+func (c *Conn) LocalAddr() net.Addr {
+	return Addr{UUID: c.t.sender.UUID()}
+}
+
+// RemoteAddr returns address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return Addr{UUID: c.peer}
+}
+
+// SetDeadline sets read and write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets deadline of Read, pending Read is affected as well
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets deadline of Write, pending Write is affected as well
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// deadline is a channel closed when the deadline expires
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		// timer function is running, wait for it
+		<-d.cancel
+	}
+	d.timer = nil
+
+	expired := isClosed(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package stream provides net.Conn connections between zyre peers,
+// multiplexed over Whisper.
+//
+// All messages are whispers with frames "ZSTREAM/1", kind, role and id,
+// role is "c" for messages of the dialing side and "s" for messages of the
+// accepting side:
+//
+//	SYN n      open a connection
+//	ACCEPT n   connection is accepted
+//	DATA data  data of the connection
+//	WIN n      n more bytes can be sent
+//	FIN        sender does not write anymore
+//	RST        connection is refused or closed
+//
+// SYN and ACCEPT carry the receive window of the sender, the number of
+// bytes the other side may send before it receives WIN.
+package stream
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	zyre "github.com/zeromq/gozyre"
+)
+
+const protocol = "ZSTREAM/1"
+
+const (
+	kindSyn    = "SYN"
+	kindAccept = "ACCEPT"
+	kindData   = "DATA"
+	kindWin    = "WIN"
+	kindFin    = "FIN"
+	kindRst    = "RST"
+)
+
+const (
+	roleDialer   = "c"
+	roleAccepter = "s"
+)
+
+const (
+	// DefaultWindow is the number of bytes sent to a connection before
+	// its reader acknowledges them
+	DefaultWindow = 256 << 10
+
+	// maxFrame limits size of one DATA message
+	maxFrame = 64 << 10
+
+	// backlog is the number of connections waiting for Accept
+	backlog = 16
+)
+
+var (
+	// ErrUnknownPeer is returned when dialing peer which is not connected
+	ErrUnknownPeer = errors.New("stream: unknown peer")
+
+	// ErrRefused is returned when the peer does not accept connections
+	ErrRefused = errors.New("stream: connection refused")
+
+	// ErrReset is returned when writing to connection closed by the peer
+	ErrReset = errors.New("stream: connection reset by peer")
+
+	// ErrPeerExit is returned when the peer exits
+	ErrPeerExit = errors.New("stream: peer exited")
+
+	// ErrListening is returned by Listen if transport has a listener
+	ErrListening = errors.New("stream: already listening")
+)
+
+// Sender sends whispers to peers, it is implemented by *zyre.Node
+type Sender interface {
+	Whisper(peer string, data ...[]byte) error
+	PeerAddress(peer string) (string, bool)
+	UUID() string
+}
+
+// Addr is an address of zyre peer
+type Addr struct {
+	UUID string
+}
+
+// Network - returns "zyre"
+func (a Addr) Network() string {
+	return "zyre"
+}
+
+func (a Addr) String() string {
+	return a.UUID
+}
+
+// Option configures Transport
+type Option func(*Transport)
+
+// Window sets the receive window of connections, the number of bytes peer
+// sends to a connection before the data are read
+func Window(n int) Option {
+	return func(t *Transport) {
+		if n > 0 {
+			t.window = n
+		}
+	}
+}
+
+// Transport dials and accepts connections of a node, it is safe for
+// concurrent use
+type Transport struct {
+	sender Sender
+	window int
+
+	id uint64
+
+	mu       sync.Mutex
+	conns    map[string]*Conn // by key
+	listener *Listener
+}
+
+// New creates a transport sending by sender (usually *zyre.Node)
+func New(sender Sender, options ...Option) *Transport {
+	t := &Transport{
+		sender: sender,
+		window: DefaultWindow,
+		conns:  make(map[string]*Conn),
+	}
+	for _, o := range options {
+		o(t)
+	}
+	return t
+}
+
+// key identifies connection, role is of the local side
+func key(peer, role, id string) string {
+	return peer + "/" + role + "/" + id
+}
+
+// Dial opens connection to peer, the peer must have a listener
+func (t *Transport) Dial(ctx context.Context, peer string) (net.Conn, error) {
+	if _, ok := t.sender.PeerAddress(peer); !ok {
+		return nil, ErrUnknownPeer
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&t.id, 1), 10)
+	c := t.newConn(peer, roleDialer, id)
+	c.accepted = make(chan error, 1)
+	t.mu.Lock()
+	t.conns[c.key] = c
+	t.mu.Unlock()
+
+	if err := c.send(kindSyn, []byte(strconv.Itoa(t.window))); err != nil {
+		t.remove(c)
+		return nil, err
+	}
+	select {
+	case err := <-c.accepted:
+		if err != nil {
+			t.remove(c)
+			return nil, err
+		}
+		return c, nil
+	case <-ctx.Done():
+		c.send(kindRst)
+		t.remove(c)
+		return nil, ctx.Err()
+	}
+}
+
+// Listen returns a listener of connections from peers, transport has at
+// most one listener
+func (t *Transport) Listen() (*Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listener != nil {
+		return nil, ErrListening
+	}
+	t.listener = &Listener{
+		t:      t,
+		accept: make(chan *Conn, backlog),
+		done:   make(chan struct{}),
+	}
+	return t.listener, nil
+}
+
+// Close closes the listener and all connections
+func (t *Transport) Close() {
+	t.mu.Lock()
+	l := t.listener
+	conns := make([]*Conn, 0, len(t.conns))
+	for _, c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+	if l != nil {
+		l.Close()
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (t *Transport) remove(c *Conn) {
+	t.mu.Lock()
+	if t.conns[c.key] == c {
+		delete(t.conns, c.key)
+	}
+	t.mu.Unlock()
+}
+
+// Dispatch handles stream messages and fails connections to peers which
+// exited. Returns true if the event was consumed by the transport, other
+// events, including Exit, should be processed by the application.
+func (t *Transport) Dispatch(e zyre.Event) bool {
+	switch m := e.(type) {
+	case zyre.Whisper:
+		if len(m.Message) < 4 || string(m.Message[0]) != protocol {
+			return false
+		}
+		t.handle(m.Peer, string(m.Message[1]), string(m.Message[2]), string(m.Message[3]), m.Message[4:])
+		return true
+	case zyre.Exit:
+		t.exit(m.Peer)
+	case zyre.Stop:
+		t.exit("")
+	}
+	return false
+}
+
+func (t *Transport) handle(peer, kind, role, id string, args [][]byte) {
+	// messages of the dialing side are for accepted connections and vice
+	// versa
+	local := roleDialer
+	if role == roleDialer {
+		local = roleAccepter
+	}
+	if kind == kindSyn {
+		if role == roleDialer && len(args) == 1 {
+			if n, err := strconv.Atoi(string(args[0])); err == nil && n > 0 {
+				t.syn(peer, id, n)
+			}
+		}
+		return
+	}
+	t.mu.Lock()
+	c, ok := t.conns[key(peer, local, id)]
+	t.mu.Unlock()
+	if !ok {
+		if kind == kindData {
+			t.sender.Whisper(peer, []byte(protocol), []byte(kindRst), []byte(local), []byte(id))
+		}
+		return
+	}
+	switch kind {
+	case kindAccept:
+		if len(args) == 1 {
+			if n, err := strconv.Atoi(string(args[0])); err == nil && n > 0 {
+				c.credit(n)
+			}
+		}
+		if c.accepted != nil {
+			select {
+			case c.accepted <- nil:
+			default:
+			}
+		}
+	case kindData:
+		if len(args) == 1 {
+			c.receive(args[0])
+		}
+	case kindWin:
+		if len(args) == 1 {
+			if n, err := strconv.Atoi(string(args[0])); err == nil && n > 0 {
+				c.credit(n)
+			}
+		}
+	case kindFin:
+		c.fin()
+	case kindRst:
+		if c.accepted != nil {
+			select {
+			case c.accepted <- ErrRefused:
+			default:
+			}
+		}
+		c.reset(ErrReset)
+		t.remove(c)
+	}
+}
+
+// syn accepts connection from peer with receive window
+func (t *Transport) syn(peer, id string, window int) {
+	c := t.newConn(peer, roleAccepter, id)
+	c.window = window
+	t.mu.Lock()
+	l := t.listener
+	_, exists := t.conns[c.key]
+	if l == nil || exists {
+		t.mu.Unlock()
+		c.send(kindRst)
+		return
+	}
+	select {
+	case l.accept <- c:
+		t.conns[c.key] = c
+		t.mu.Unlock()
+		c.send(kindAccept, []byte(strconv.Itoa(t.window)))
+	default:
+		t.mu.Unlock()
+		c.send(kindRst)
+	}
+}
+
+// exit fails connections of peer, or of all peers if peer is empty
+func (t *Transport) exit(peer string) {
+	var failed []*Conn
+	t.mu.Lock()
+	for k, c := range t.conns {
+		if peer == "" || c.peer == peer {
+			failed = append(failed, c)
+			delete(t.conns, k)
+		}
+	}
+	t.mu.Unlock()
+	for _, c := range failed {
+		if c.accepted != nil {
+			select {
+			case c.accepted <- ErrPeerExit:
+			default:
+			}
+		}
+		c.reset(ErrPeerExit)
+	}
+}
+
+// Listener accepts connections from peers, it implements net.Listener
+type Listener struct {
+	t      *Transport
+	accept chan *Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Accept waits for the next connection
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting of connections, connections waiting for Accept are
+// closed
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		l.t.mu.Lock()
+		if l.t.listener == l {
+			l.t.listener = nil
+		}
+		l.t.mu.Unlock()
+		close(l.done)
+		for {
+			select {
+			case c := <-l.accept:
+				c.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Addr returns address of the node
+func (l *Listener) Addr() net.Addr {
+	return Addr{UUID: l.t.sender.UUID()}
+}
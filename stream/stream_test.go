@@ -0,0 +1,258 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromq/gozyre/internal/testpeer"
+)
+
+// peer is a node with stream transport fed by its events
+type peer struct {
+	*testpeer.Peer
+	transport *Transport
+	once      sync.Once
+}
+
+func newPeer(t *testing.T, name string, options ...Option) *peer {
+	p := &peer{Peer: testpeer.New(t, name, 5685)}
+	p.transport = New(p.Node, options...)
+	p.Start(t, p.transport.Dispatch)
+	return p
+}
+
+func (p *peer) close() {
+	p.once.Do(func() {
+		p.transport.Close()
+		p.Close()
+	})
+}
+
+// kill stops the node without closing connections
+func (p *peer) kill() {
+	p.once.Do(p.Close)
+}
+
+// pair returns connected peers, the second one listens
+func pair(t *testing.T, options ...Option) (*peer, *peer, *Listener) {
+	client := newPeer(t, "client", options...)
+	server := newPeer(t, "server", options...)
+	client.WaitEnter(t, server.Node.UUID())
+	l, err := server.transport.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server, l
+}
+
+func TestStream(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client, server, l := pair(t, Window(16<<10))
+	defer client.close()
+	defer server.close()
+	_, err := server.transport.Listen()
+	assert.Equal(ErrListening, err)
+
+	// echo server
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.(*Conn).CloseWrite()
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := client.transport.Dial(ctx, server.Node.UUID())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(Addr{UUID: server.Node.UUID()}, conn.RemoteAddr())
+	assert.Equal("zyre", conn.LocalAddr().Network())
+
+	// data many times larger than window pass in both directions
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	go func() {
+		conn.Write(data)
+		conn.(*Conn).CloseWrite()
+	}()
+	got, err := io.ReadAll(conn)
+	assert.NoError(err)
+	assert.True(bytes.Equal(data, got))
+	assert.NoError(conn.Close())
+	assert.Equal(net.ErrClosed, conn.Close())
+
+	_, err = client.transport.Dial(ctx, "NO-SUCH-PEER")
+	assert.Equal(ErrUnknownPeer, err)
+
+	// accepting side without listener refuses connections
+	_, err = server.transport.Dial(ctx, client.Node.UUID())
+	assert.Equal(ErrRefused, err)
+}
+
+type Arith struct{}
+
+func (Arith) Add(args [2]int, reply *int) error {
+	*reply = args[0] + args[1]
+	return nil
+}
+
+func TestStreamRPC(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client, server, l := pair(t)
+	defer client.close()
+	defer server.close()
+
+	s := rpc.NewServer()
+	s.Register(Arith{})
+	go s.Accept(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := client.transport.Dial(ctx, server.Node.UUID())
+	if !assert.NoError(err) {
+		return
+	}
+	c := rpc.NewClient(conn)
+	defer c.Close()
+	for i := 0; i != 10; i++ {
+		var sum int
+		assert.NoError(c.Call("Arith.Add", [2]int{i, 40}, &sum))
+		assert.Equal(i+40, sum)
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client, server, l := pair(t, Window(1024))
+	defer client.close()
+	defer server.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	conn, err := client.transport.Dial(ctx, server.Node.UUID())
+	if !assert.NoError(err) {
+		return
+	}
+	sconn := <-accepted
+
+	// read deadline of pending Read
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sconn.SetReadDeadline(time.Now())
+	}()
+	_, err = sconn.Read(make([]byte, 10))
+	assert.True(errors.Is(err, os.ErrDeadlineExceeded))
+	sconn.SetReadDeadline(time.Time{})
+
+	// write blocks on full window of peer which does not read
+	conn.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := conn.Write(make([]byte, 4096))
+	assert.True(errors.Is(err, os.ErrDeadlineExceeded))
+	assert.Equal(1024, n)
+	conn.SetWriteDeadline(time.Time{})
+
+	// half-close, data are read before EOF and the other direction works
+	assert.NoError(conn.(*Conn).CloseWrite())
+	_, err = conn.Write([]byte("x"))
+	assert.Equal(net.ErrClosed, err)
+	got, err := io.ReadAll(sconn)
+	assert.NoError(err)
+	assert.Len(got, 1024)
+	_, err = sconn.Write([]byte("reply"))
+	assert.NoError(err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.NoError(err)
+	assert.Equal("reply", string(buf))
+
+	// closed by peer
+	assert.NoError(sconn.Close())
+	_, err = conn.Read(buf)
+	assert.Equal(io.EOF, err)
+
+	// peer exit
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	conn, err = client.transport.Dial(ctx, server.Node.UUID())
+	if !assert.NoError(err) {
+		return
+	}
+	<-accepted
+	server.kill()
+	_, err = conn.Read(buf)
+	assert.Equal(ErrPeerExit, err)
+	_, err = conn.Write(buf)
+	assert.Equal(ErrPeerExit, err)
+}
+
+// discard is a sender dropping all whispers
+type discard struct{}
+
+func (discard) Whisper(peer string, data ...[]byte) error { return nil }
+func (discard) PeerAddress(peer string) (string, bool)    { return "", true }
+func (discard) UUID() string                              { return "SELF" }
+
+func TestConnWakeup(t *testing.T) {
+
+	assert := assert.New(t)
+
+	// every blocked Read and Write wakes up, not only one of them
+	c := New(discard{}).newConn("PEER", "c", "1")
+	const n = 4
+	results := make(chan error, 2*n)
+	for i := 0; i != n; i++ {
+		go func() {
+			_, err := c.Read(make([]byte, 1))
+			results <- err
+		}()
+		go func() {
+			_, err := c.Write([]byte("x"))
+			results <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.reset(ErrReset)
+	for i := 0; i != 2*n; i++ {
+		select {
+		case err := <-results:
+			assert.Equal(ErrReset, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d blocked calls woken up", i, 2*n)
+		}
+	}
+}
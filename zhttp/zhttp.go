@@ -0,0 +1,132 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+// Package zhttp carries HTTP requests between zyre peers over connections
+// of package stream.
+//
+// Requests are sent to URLs with scheme "zyre" and the peer as host, either
+// its UUID or its name, for example zyre://printer/status. Names must be
+// valid host names and unique among peers. The other peer serves requests
+// by a normal http.Handler:
+//
+//	l, _ := streams.Listen()
+//	go zhttp.Serve(l, handler)
+//
+//	client := &http.Client{Transport: zhttp.NewTransport(streams, node)}
+//	resp, err := client.Get("zyre://printer/status")
+//
+// Request and response bodies are streamed. As with any HTTP/1.1 server,
+// handlers which write the response before the request body is read must
+// call http.ResponseController.EnableFullDuplex.
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/zeromq/gozyre/stream"
+)
+
+// Scheme is URL scheme of requests to peers
+const Scheme = "zyre"
+
+var (
+	// ErrUnknownPeer is returned when no peer has UUID or name of the host
+	ErrUnknownPeer = errors.New("zhttp: unknown peer")
+
+	// ErrAmbiguousPeer is returned when more peers have name of the host
+	ErrAmbiguousPeer = errors.New("zhttp: ambiguous peer name")
+)
+
+// Resolver finds peers by name, it is implemented by *zyre.Node
+type Resolver interface {
+	Peers() []string
+	PeerName(peer string) (string, bool)
+}
+
+// Transport sends requests to peers, it implements http.RoundTripper.
+// Connections are kept for following requests like by http.Transport.
+type Transport struct {
+	streams  *stream.Transport
+	resolver Resolver
+	http     *http.Transport
+}
+
+// NewTransport creates transport dialing connections by streams and
+// resolving peer names by resolver (usually *zyre.Node)
+func NewTransport(streams *stream.Transport, resolver Resolver) *Transport {
+	t := &Transport{
+		streams:  streams,
+		resolver: resolver,
+	}
+	t.http = &http.Transport{
+		DialContext: t.dial,
+	}
+	return t
+}
+
+// RoundTrip sends request to peer, request body and response body are
+// streamed and the request is cancelled with its context
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil || req.URL.Scheme != Scheme {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("zhttp: unsupported URL %v", req.URL)
+	}
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	resp, err := t.http.RoundTrip(r)
+	if resp != nil {
+		resp.Request = req
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes connections which are not in use
+func (t *Transport) CloseIdleConnections() {
+	t.http.CloseIdleConnections()
+}
+
+func (t *Transport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	peer, err := t.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	return t.streams.Dial(ctx, peer)
+}
+
+// resolve returns UUID of peer with UUID or name host
+func (t *Transport) resolve(host string) (string, error) {
+	if _, ok := t.resolver.PeerName(host); ok {
+		return host, nil
+	}
+	peer := ""
+	for _, uuid := range t.resolver.Peers() {
+		if name, ok := t.resolver.PeerName(uuid); ok && name == host {
+			if peer != "" {
+				return "", fmt.Errorf("%w: %s", ErrAmbiguousPeer, host)
+			}
+			peer = uuid
+		}
+	}
+	if peer == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownPeer, host)
+	}
+	return peer, nil
+}
+
+// Serve serves requests from connections of l by handler, it returns when
+// l is closed. RemoteAddr of requests is UUID of the requesting peer.
+func Serve(l net.Listener, handler http.Handler) error {
+	srv := &http.Server{Handler: handler}
+	return srv.Serve(l)
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+package zhttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromq/gozyre/internal/testpeer"
+	"github.com/zeromq/gozyre/stream"
+)
+
+// peer is a node with stream transport fed by its events
+type peer struct {
+	*testpeer.Peer
+	streams *stream.Transport
+}
+
+func newPeer(t *testing.T, name string) *peer {
+	p := &peer{Peer: testpeer.New(t, name, 5686)}
+	p.streams = stream.New(p.Node)
+	p.Start(t, p.streams.Dispatch)
+	return p
+}
+
+func (p *peer) close() {
+	p.streams.Close()
+	p.Close()
+}
+
+func TestHTTP(t *testing.T) {
+
+	assert := assert.New(t)
+
+	client := newPeer(t, "client")
+	defer client.close()
+	server := newPeer(t, "printer")
+	defer server.close()
+	client.WaitEnter(t, server.Node.UUID())
+
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(client.Node.UUID(), r.RemoteAddr)
+		w.Header().Set("X-Printer", "ready")
+		io.WriteString(w, "ok "+r.URL.Query().Get("q"))
+	})
+	mux.HandleFunc("/upper", func(w http.ResponseWriter, r *http.Request) {
+		http.NewResponseController(w).EnableFullDuplex()
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			io.WriteString(w, strings.ToUpper(scanner.Text())+"\n")
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	})
+	mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	})
+	l, err := server.streams.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Serve(l, mux)
+
+	c := &http.Client{Transport: NewTransport(client.streams, client.Node)}
+
+	// by name and by UUID
+	for _, host := range []string{"printer", server.Node.UUID()} {
+		resp, err := c.Get("zyre://" + host + "/status?q=" + host)
+		if !assert.NoError(err) {
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal("ready", resp.Header.Get("X-Printer"))
+		assert.Equal("ok "+host, string(body))
+		assert.Equal("zyre", resp.Request.URL.Scheme)
+	}
+
+	// request body is streamed
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "hello\n")
+	}()
+	resp, err := c.Post("zyre://printer/upper", "text/plain", pr)
+	if assert.NoError(err) {
+		lines := bufio.NewReader(resp.Body)
+		line, _ := lines.ReadString('\n')
+		assert.Equal("HELLO\n", line)
+		io.WriteString(pw, "world\n")
+		pw.Close()
+		line, _ = lines.ReadString('\n')
+		assert.Equal("WORLD\n", line)
+		resp.Body.Close()
+	}
+
+	// response body is streamed
+	resp, err = c.Get("zyre://printer/stream")
+	if assert.NoError(err) {
+		lines := bufio.NewReader(resp.Body)
+		line, _ := lines.ReadString('\n')
+		assert.Equal("first\n", line)
+		close(release)
+		rest, _ := io.ReadAll(lines)
+		assert.Equal("second\n", string(rest))
+		resp.Body.Close()
+	}
+
+	// request context cancels the handler
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	req, _ := http.NewRequestWithContext(ctx, "GET", "zyre://printer/block", nil)
+	_, err = c.Do(req)
+	cancel()
+	assert.True(errors.Is(err, context.DeadlineExceeded), "%v", err)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("handler was not cancelled")
+	}
+
+	_, err = c.Get("zyre://scanner/status")
+	assert.True(errors.Is(err, ErrUnknownPeer), "%v", err)
+	_, err = c.Get("http://printer/status")
+	assert.Error(err)
+}
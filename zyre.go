@@ -2,6 +2,9 @@
 // Use of this source code is governed by a MPL-2.0
 // license that can be found in the LICENSE file.
 
+//go:build !purego && cgo
+// +build !purego,cgo
+
 package zyre
 
 //#cgo pkg-config: libzmq
@@ -29,86 +32,177 @@ package zyre
 //const char *_zlist_nexts(zlist_t *hash) {
 //   return (const char*)zlist_next(hash);
 //}
+//int _zyre_poll(zyre_t *self, int wake, long timeout) {
+//  zmq_pollitem_t items [] = {
+//    {zsock_resolve(zyre_socket(self)), 0, ZMQ_POLLIN, 0},
+//    {NULL, wake, ZMQ_POLLIN, 0}};
+//  int rc = zmq_poll(items, 2, timeout);
+//  if (rc <= 0) {
+//    return rc;
+//  }
+//  return items[1].revents & ZMQ_POLLIN ? 2 : 1;
+//}
+//int _zyre_poll_many(zyre_t **nodes, int nnodes, int *fds, int nfds, long timeout, short *revents) {
+//  int n = nnodes + nfds;
+//  zmq_pollitem_t items [n > 0 ? n : 1];
+//  for (int i = 0; i < nnodes; i++) {
+//    zmq_pollitem_t item = {zsock_resolve(zyre_socket(nodes[i])), 0, ZMQ_POLLIN, 0};
+//    items[i] = item;
+//  }
+//  for (int i = 0; i < nfds; i++) {
+//    zmq_pollitem_t item = {NULL, fds[i], ZMQ_POLLIN, 0};
+//    items[nnodes + i] = item;
+//  }
+//  int rc = zmq_poll(items, n, timeout);
+//  for (int i = 0; i < n; i++) {
+//    revents[i] = items[i].revents;
+//  }
+//  return rc;
+//}
 import "C"
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
 	"unsafe"
 )
 
-var (
-	// ErrStart is returned when node fails to start
-	ErrStart = errors.New("zyre_start returned -1")
-
-	// ErrJoin is returned when node fails to join the group
-	ErrJoin = errors.New("zyre_join returned -1")
-
-	// ErrLeave is returned when node fails to leave the group
-	ErrLeave = errors.New("zyre_leave returned -1")
+// recvPollInterval is the longest time RecvContext waits inside zmq_poll
+// before it checks the context again
+const recvPollInterval = 100 * time.Millisecond
 
-	// ErrRecvNil is returned when recv got nil pointer
-	ErrRecvNil = errors.New("zyre_recv got nil")
-
-	// ErrRecvNilEvent is returned when recv got nil pointer
-	ErrRecvNilEvent = errors.New("zyre_recv got nil event")
-)
-
-// Node is opaque Golang struct wrapping `zyre_t*`
+// Node is opaque Golang struct wrapping `zyre_t*`. It is safe for concurrent
+// use, sending and queries can be done while another goroutine waits in Recv.
 type Node struct {
 	ptr  *C.zyre_t
 	uuid string
 	name string
+
+	// mu serializes commands sent through zyre actor, recvMu serializes
+	// reading of node inbox, so a pending Recv does not block other calls
+	mu     sync.Mutex
+	recvMu sync.Mutex
+
+	// wake is a pipe written by Destroy, it is polled together with node
+	// inbox, so Destroy interrupts pending Recv and Poller.Wait
+	wakeR, wakeW *os.File
+
+	// users counts Recv and Poller.Wait calls using ptr without holding mu,
+	// Destroy waits until they return
+	useMu     sync.Mutex
+	useCond   sync.Cond
+	users     int
+	destroyed bool
+
+	// state tracked from events received by Recv: leaders of groups and
+	// names of headers of peers, libzyre has no call returning all headers
+	trackMu sync.Mutex
+	leaders map[string]string
+	headers map[string][]string
 }
 
 // New creates a new zyre.Node. Note that until you Start the
 // node it is silent and invisible to other nodes on the network.
-func New(name string, options ...Option) *Node {
-	ptr := C.zyre_new(C.CString(name))
-	z := &Node{
-		ptr:  ptr,
-		uuid: "",
-		name: "",
+func New(name string, options ...Option) (*Node, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
 	}
-	for _, o := range options {
-		o(z)
-	}
-	return z
+	cname, free := cString(name)
+	defer free()
+	return newNode(C.zyre_new(cname), options)
 }
 
-// New creates a new zyre.Node with unique name. Note that until you Start the
-// node it is silent and invisible to other nodes on the network.
-func NewUnique(options ...Option) *Node {
-	ptr := C.zyre_new(nil)
-	z := &Node{
-		ptr:  ptr,
-		uuid: "",
-		name: "",
+// NewUnique creates a new zyre.Node with unique name. Note that until you
+// Start the node it is silent and invisible to other nodes on the network.
+func NewUnique(options ...Option) (*Node, error) {
+	return newNode(C.zyre_new(nil), options)
+}
+
+func newNode(ptr *C.zyre_t, options []Option) (*Node, error) {
+	if ptr == nil {
+		return nil, ErrNew
 	}
-	for _, o := range options {
-		o(z)
+	wakeR, wakeW, err := os.Pipe()
+	if err != nil {
+		C.zyre_destroy(&ptr)
+		return nil, ErrNew
 	}
-	return z
+	z := &Node{
+		ptr:     ptr,
+		uuid:    "",
+		name:    "",
+		wakeR:   wakeR,
+		wakeW:   wakeW,
+		leaders: make(map[string]string),
+		headers: make(map[string][]string),
+	}
+	z.useCond.L = &z.useMu
+	return z.apply(options)
 }
 
-// Option is a type for setting up the underlying Zyre actor
-type Option func(*Node)
-
 // Destroy - destroys a Node node. When you destroy a node, any messages it is
-// sending or receiving will be discarded. It frees underlying C memory
+// sending or receiving will be discarded. It frees underlying C memory.
+// Pending Recv and Poller.Wait are interrupted, Recv returns ErrRecvNil.
 func (z *Node) Destroy() {
-	if z.ptr == nil {
+	z.useMu.Lock()
+	if z.destroyed {
+		z.useMu.Unlock()
 		return
 	}
+	z.destroyed = true
+	// the pipe is never read, so it stays readable for all pollers
+	z.wakeW.Write([]byte{0})
+	for z.users > 0 {
+		z.useCond.Wait()
+	}
+	z.useMu.Unlock()
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
 	C.zyre_destroy(&z.ptr)
 	z.ptr = nil
+	z.wakeR.Close()
+	z.wakeW.Close()
 }
 
-// UUID - Return our node UUID string, after successful initialization
-func (z *Node) UUID() string {
+// lock locks zyre actor for a command, panics if the node was destroyed
+func (z *Node) lock(method string) {
+	z.mu.Lock()
 	if z.ptr == nil {
-		panic("Node.UUID: z.ptr is null")
+		z.mu.Unlock()
+		panic(method + ": z.ptr is null")
+	}
+}
+
+// acquire registers user of ptr, so Destroy waits until it calls release.
+// Returns false if the node is destroyed.
+func (z *Node) acquire() bool {
+	z.useMu.Lock()
+	defer z.useMu.Unlock()
+	if z.destroyed {
+		return false
 	}
+	z.users++
+	return true
+}
+
+func (z *Node) release() {
+	z.useMu.Lock()
+	defer z.useMu.Unlock()
+	z.users--
+	if z.users == 0 {
+		z.useCond.Broadcast()
+	}
+}
+
+// UUID - Return our node UUID string, after successful initialization
+func (z *Node) UUID() string {
+	z.lock("Node.UUID")
+	defer z.mu.Unlock()
 	if z.uuid == "" {
 		z.uuid = C.GoString(C.zyre_uuid(z.ptr))
 	}
@@ -117,9 +211,8 @@ func (z *Node) UUID() string {
 
 // Name - return our node name, after successful initialization
 func (z *Node) Name() string {
-	if z.ptr == nil {
-		panic("Node.Name: z.ptr is null")
-	}
+	z.lock("Node.Name")
+	defer z.mu.Unlock()
 	if z.name == "" {
 		z.name = C.GoString(C.zyre_name(z.ptr))
 	}
@@ -133,13 +226,18 @@ func (z *Node) Name() string {
 // endpoint MUST be valid for both bind and connect operations. You can use
 // inproc://, ipc://, or tcp:// transports (for tcp://, use an IP address
 // that is meaningful to remote as well as local nodes). Returns error if
-// operation zas not succesfull
+// operation zas not succesfull, ErrConfig if endpoint is not
+// transport://address.
 func (z *Node) SetEndpoint(format string, a ...interface{}) error {
-	if z.ptr == nil {
-		panic("Node.SetEndpoint: z.ptr is null")
-	}
 	s := fmt.Sprintf(format, a...)
-	rc := C._zyre_set_endpoint(z.ptr, C.CString(s))
+	if err := checkEndpoint("endpoint", s); err != nil {
+		return err
+	}
+	z.lock("Node.SetEndpoint")
+	defer z.mu.Unlock()
+	cs, free := cString(s)
+	defer free()
+	rc := C._zyre_set_endpoint(z.ptr, cs)
 	if rc == -1 {
 		return fmt.Errorf("Node.SetEndpoint: returned -1")
 	}
@@ -151,31 +249,32 @@ func (z *Node) SetEndpoint(format string, a ...interface{}) error {
 // it. Note that gossip endpoints are completely distinct from Node node
 // endpoints, and should not overlap (they can use the same transport).
 func (z *Node) GossipBind(format string, a ...interface{}) {
-	if z.ptr == nil {
-		panic("Node.GossipBind: z.ptr is null")
-	}
+	z.lock("Node.GossipBind")
+	defer z.mu.Unlock()
 	s := fmt.Sprintf(format, a...)
-	C._zyre_gossip_bind(z.ptr, C.CString(s))
+	cs, free := cString(s)
+	defer free()
+	C._zyre_gossip_bind(z.ptr, cs)
 }
 
 // GossipConnect - Set-up gossip discovery of other nodes. A node may connect to multiple
 // other nodes, for redundancy paths. For details of the gossip network
 // design, see the CZMQ zgossip class.
 func (z *Node) GossipConnect(format string, a ...interface{}) {
-	if z.ptr == nil {
-		panic("Node.GossipConnect: z.ptr is null")
-	}
+	z.lock("Node.GossipConnect")
+	defer z.mu.Unlock()
 	s := fmt.Sprintf(format, a...)
-	C._zyre_gossip_connect(z.ptr, C.CString(s))
+	cs, free := cString(s)
+	defer free()
+	C._zyre_gossip_connect(z.ptr, cs)
 }
 
 // Start - starts a node, after setting header values. When you start a node it
 // begins discovery and connection. Returns error if it wasn't
 // possible to start the node.
 func (z *Node) Start() error {
-	if z.ptr == nil {
-		panic("Node.Start: z.ptr is null")
-	}
+	z.lock("Node.Start")
+	defer z.mu.Unlock()
 	rc := C.zyre_start(z.ptr)
 	if rc == -1 {
 		return ErrStart
@@ -187,19 +286,19 @@ func (z *Node) Start() error {
 // This is polite; however you can also just destroy the node without
 // stopping it.
 func (z *Node) Stop() {
-	if z.ptr == nil {
-		panic("Node.Stop: z.ptr is null")
-	}
+	z.lock("Node.Stop")
+	defer z.mu.Unlock()
 	C.zyre_stop(z.ptr)
 }
 
 // Join a named group; after joining a group you can send messages to
 // the group and all Node nodes in that group will receive them.
 func (z *Node) Join(room string) error {
-	if z.ptr == nil {
-		panic("Node.Join: z.ptr is null")
-	}
-	rc := C.zyre_join(z.ptr, C.CString(room))
+	z.lock("Node.Join")
+	defer z.mu.Unlock()
+	croom, free := cString(room)
+	defer free()
+	rc := C.zyre_join(z.ptr, croom)
 	if rc == -1 {
 		return ErrJoin
 	}
@@ -208,24 +307,65 @@ func (z *Node) Join(room string) error {
 
 // Leave a group
 func (z *Node) Leave(room string) error {
-	if z.ptr == nil {
-		panic("Node.Leave: z.ptr is null")
-	}
-	rc := C.zyre_leave(z.ptr, C.CString(room))
+	z.lock("Node.Leave")
+	defer z.mu.Unlock()
+	croom, free := cString(room)
+	defer free()
+	rc := C.zyre_leave(z.ptr, croom)
 	if rc == -1 {
 		return ErrLeave
 	}
+	z.trackMu.Lock()
+	delete(z.leaders, room)
+	z.trackMu.Unlock()
 	return nil
 }
 
 // Recv - Receive next message from network; the message may be a control
 // message (Enter, Exit, Join, Leave) or data (Whisper, Shout).
-// called must use type switch and type assertions to get the exact type
-// Returns error on recv error (unpacking the message, or interrupted)
-func (z *Node) Recv() (m interface{}, err error) {
-	if z.ptr == nil {
-		panic("Node.Recv: z.ptr is null")
+// Caller can use Event methods or type switch and type assertions to get
+// the exact type.
+// Returns error on recv error (unpacking the message, or interrupted),
+// ErrRecvNil if the node is destroyed.
+func (z *Node) Recv() (m Event, err error) {
+	for {
+		var ok bool
+		m, ok, err = z.recvPoll(-1)
+		if ok {
+			return
+		}
 	}
+}
+
+// recvPoll waits at most ms milliseconds, or forever for -1, until a message
+// or Destroy arrives and receives the message. Returns ok false on timeout
+// or when interrupted by a signal.
+func (z *Node) recvPoll(ms C.long) (m Event, ok bool, err error) {
+	if !z.acquire() {
+		return nil, true, ErrRecvNil
+	}
+	defer z.release()
+	// keep the inbox locked between poll and recv, so other goroutine
+	// can't take the message and leave us blocked
+	z.recvMu.Lock()
+	defer z.recvMu.Unlock()
+	rc, errno := C._zyre_poll(z.ptr, C.int(z.wakeR.Fd()), ms)
+	switch {
+	case rc == -1 && errno == syscall.EINTR:
+		return nil, false, nil
+	case rc == -1:
+		return nil, true, ErrPoll
+	case rc == 0:
+		return nil, false, nil
+	case rc == 2:
+		return nil, true, ErrRecvNil
+	}
+	m, err = z.recv()
+	return m, true, err
+}
+
+// recv receives message from node inbox, caller must hold recvMu
+func (z *Node) recv() (m Event, err error) {
 	msg := C.zyre_recv(z.ptr)
 	if msg == nil {
 		err = ErrRecvNil
@@ -243,96 +383,155 @@ func (z *Node) Recv() (m interface{}, err error) {
 
 	switch event {
 	case "ENTER":
-		return recvEnter(msg)
+		m, err = recvEnter(msg)
 	case "EVASIVE":
-		return recvEvasive(msg)
+		m, err = recvEvasive(msg)
 	case "EXIT":
-		return recvExit(msg)
+		m, err = recvExit(msg)
 	case "JOIN":
-		return recvJoin(msg)
+		m, err = recvJoin(msg)
 	case "LEAVE":
-		return recvLeave(msg)
+		m, err = recvLeave(msg)
 	case "WHISPER":
-		return recvWhisper(msg)
+		m, err = recvWhisper(msg)
 	case "SHOUT":
-		return recvShout(msg)
+		m, err = recvShout(msg)
 	case "STOP":
-		return recvStop(msg)
+		m, err = recvStop(msg)
+	case "LEADER":
+		m, err = recvLeader(msg)
 	default:
 		err = fmt.Errorf("NodeRecv: uknown event '%s'", event)
+	}
+	if err != nil {
+		m = nil
 		return
 	}
+	z.track(m)
+	return
 }
 
-// Whisper - sends byte slice to a single peer specified as UUID string
-func (z *Node) Whisper(peer string, data ...[]byte) error {
-	if z.ptr == nil {
-		panic("Node.Whisper: z.ptr is null")
-	}
-	msg := C.zmsg_new()
-	if msg == nil {
-		return fmt.Errorf("Node.Whisper: can't create zmsg_t")
+// track updates leaders of groups and names of headers of peers from
+// received event
+func (z *Node) track(m Event) {
+	z.trackMu.Lock()
+	defer z.trackMu.Unlock()
+	switch m := m.(type) {
+	case Enter:
+		names := make([]string, 0, len(m.Headers))
+		for k := range m.Headers {
+			names = append(names, k)
+		}
+		z.headers[m.Peer] = names
+	case Stop:
+		z.headers = make(map[string][]string)
+	case Leader:
+		z.leaders[m.Group] = m.Peer
+	case Leave:
+		if z.leaders[m.Group] == m.Peer {
+			delete(z.leaders, m.Group)
+		}
+	case Exit:
+		delete(z.headers, m.Peer)
+		for group, peer := range z.leaders {
+			if peer == m.Peer {
+				delete(z.leaders, group)
+			}
+		}
 	}
-	// we do not defer as zmsg_t will get destroyed ...
-	for _, d := range data {
-		rc := C.zmsg_addmem(
-			msg,
-			C.CBytes(d),
-			C.size_t(len(data)))
-		if rc == -1 {
-			C.zmsg_destroy(&msg)
-			return fmt.Errorf("Node.Whisper: can't add memory buffer")
+}
+
+// RecvContext - Receive next message from network like Recv, but gives up
+// when ctx is cancelled or its deadline expires. It polls the zyre_socket
+// actor pipe and calls Recv only when a message is ready, so the node stays
+// usable after cancellation. Returns ctx.Err() if ctx is done before
+// a message arrives, ErrRecvNil if the node is destroyed.
+func (z *Node) RecvContext(ctx context.Context) (m Event, err error) {
+	for {
+		err = ctx.Err()
+		if err != nil {
+			return
+		}
+		timeout := recvPollInterval
+		if deadline, ok := ctx.Deadline(); ok {
+			if d := time.Until(deadline); d < timeout {
+				timeout = d
+			}
+		}
+		if timeout < 0 {
+			timeout = 0
+		}
+		// round up, so we do not spin on sub-millisecond timeouts
+		ms := (timeout + time.Millisecond - 1) / time.Millisecond
+		var ok bool
+		m, ok, err = z.recvPoll(C.long(ms))
+		if ok {
+			return
 		}
 	}
+}
+
+// RecvTimeout - Receive next message from network like Recv, but gives up
+// after timeout. Returns context.DeadlineExceeded if no message arrived in time.
+func (z *Node) RecvTimeout(timeout time.Duration) (m Event, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return z.RecvContext(ctx)
+}
+
+// Whisper - sends byte slice to a single peer specified as UUID string
+func (z *Node) Whisper(peer string, data ...[]byte) error {
+	z.lock("Node.Whisper")
+	defer z.mu.Unlock()
+	msg, err := newZmsg("Node.Whisper", data)
+	if err != nil {
+		return err
+	}
+	cpeer, free := cString(peer)
+	defer free()
+	// we do not defer as zmsg_t will get destroyed ...
 	rc := C.zyre_whisper(
 		z.ptr,
-		C.CString(peer),
+		cpeer,
 		&msg) // .... <- HERE
 	if rc == -1 {
-		return fmt.Errorf("Node.Whispers failed, returned -1")
+		return fmt.Errorf("Node.Whisper failed, returned -1")
 	}
 	return nil
 }
 
 // WhisperString - sends formatted string to a single peer specified as UUID string
 func (z *Node) WhisperString(peer string, format string, a ...interface{}) error {
-	if z.ptr == nil {
-		panic("Node.Whispers: z.ptr is null")
-	}
-	s := fmt.Sprintf(format, a...)
+	z.lock("Node.Whispers")
+	defer z.mu.Unlock()
+	cpeer, free := cString(peer)
+	defer free()
+	cs, free := cString(fmt.Sprintf(format, a...))
+	defer free()
 	rc := C._zyre_whispers(
 		z.ptr,
-		C.CString(peer),
-		C.CString(s))
+		cpeer,
+		cs)
 	if rc == -1 {
-		return fmt.Errorf("Node.Whispers failed, returned -1")
+		return fmt.Errorf("Node.Whisper failed, returned -1")
 	}
 	return nil
 }
 
 // Shout - sends byte slice to a single peer specified as UUID string
 func (z *Node) Shout(group string, data ...[]byte) error {
-	if z.ptr == nil {
-		panic("Node.Shout: z.ptr is null")
-	}
-	msg := C.zmsg_new()
-	if msg == nil {
-		return fmt.Errorf("Node.Shout: can't create zmsg_t")
-	}
+	z.lock("Node.Shout")
+	defer z.mu.Unlock()
+	msg, err := newZmsg("Node.Shout", data)
+	if err != nil {
+		return err
+	}
+	cgroup, free := cString(group)
+	defer free()
 	// we do not defer as zmsg_t will get destroyed ...
-	for _, d := range data {
-		rc := C.zmsg_addmem(
-			msg,
-			C.CBytes(d),
-			C.size_t(len(data)))
-		if rc == -1 {
-			C.zmsg_destroy(&msg)
-			return fmt.Errorf("Node.Whisper: can't add memory buffer")
-		}
-	}
 	rc := C.zyre_shout(
 		z.ptr,
-		C.CString(group),
+		cgroup,
 		&msg) // ... <- HERE
 	if rc == -1 {
 		return fmt.Errorf("Node.Shout failed, returned -1")
@@ -342,20 +541,109 @@ func (z *Node) Shout(group string, data ...[]byte) error {
 
 // ShoutString - Send formatted string to a named group
 func (z *Node) ShoutString(group string, format string, a ...interface{}) error {
-	if z.ptr == nil {
-		panic("Node.Shouts: z.ptr is null")
-	}
-	s := fmt.Sprintf(format, a...)
+	z.lock("Node.Shouts")
+	defer z.mu.Unlock()
+	cgroup, free := cString(group)
+	defer free()
+	cs, free := cString(fmt.Sprintf(format, a...))
+	defer free()
 	rc := C._zyre_shouts(
 		z.ptr,
-		C.CString(group),
-		C.CString(s))
+		cgroup,
+		cs)
 	if rc == -1 {
 		return fmt.Errorf("Node.Shouts failed, returned -1")
 	}
 	return nil
 }
 
+// pollNodes waits until inboxes of some nodes or file descriptors are
+// readable. Destroyed nodes are reported as readable, their Recv returns
+// ErrRecvNil.
+func pollNodes(nodes []*Node, fds []int, timeout time.Duration) ([]*Node, []int, error) {
+	var destroyed []*Node
+	for _, z := range nodes {
+		if !z.acquire() {
+			destroyed = append(destroyed, z)
+			continue
+		}
+		defer z.release()
+	}
+	if len(destroyed) > 0 {
+		return destroyed, nil, nil
+	}
+	// wake pipes of nodes are polled before fds, so Destroy interrupts
+	// the poll
+	ptrs := make([]*C.zyre_t, len(nodes)+1)
+	cfds := make([]C.int, len(nodes)+len(fds)+1)
+	for i, z := range nodes {
+		ptrs[i] = z.ptr
+		cfds[i] = C.int(z.wakeR.Fd())
+	}
+	for i, fd := range fds {
+		cfds[len(nodes)+i] = C.int(fd)
+	}
+	revents := make([]C.short, 2*len(nodes)+len(fds)+1)
+	ms := C.long(-1)
+	if timeout >= 0 {
+		// round up, so we do not spin on sub-millisecond timeouts
+		ms = C.long((timeout + time.Millisecond - 1) / time.Millisecond)
+	}
+	rc, errno := C._zyre_poll_many(
+		&ptrs[0], C.int(len(nodes)),
+		&cfds[0], C.int(len(nodes)+len(fds)),
+		ms, &revents[0])
+	if rc == -1 {
+		if errno == syscall.EINTR {
+			return nil, nil, nil
+		}
+		return nil, nil, ErrPoll
+	}
+	var readyNodes []*Node
+	var readyFds []int
+	for i, z := range nodes {
+		if (revents[i]|revents[len(nodes)+i])&C.ZMQ_POLLIN != 0 {
+			readyNodes = append(readyNodes, z)
+		}
+	}
+	for i, fd := range fds {
+		if revents[2*len(nodes)+i]&C.ZMQ_POLLIN != 0 {
+			readyFds = append(readyFds, fd)
+		}
+	}
+	return readyNodes, readyFds, nil
+}
+
+// cString returns C copy of s and a function freeing it, the usual pattern is
+//
+//	cs, free := cString(s)
+//	defer free()
+func cString(s string) (*C.char, func()) {
+	cs := C.CString(s)
+	return cs, func() { C.free(unsafe.Pointer(cs)) }
+}
+
+// newZmsg creates `zmsg_t*` with a frame for each byte slice. zmsg_addmem
+// copies the data, so Go memory can be passed to it directly.
+func newZmsg(method string, data [][]byte) (*C.zmsg_t, error) {
+	msg := C.zmsg_new()
+	if msg == nil {
+		return nil, fmt.Errorf("%s: can't create zmsg_t", method)
+	}
+	for _, d := range data {
+		var p unsafe.Pointer
+		if len(d) > 0 {
+			p = unsafe.Pointer(&d[0])
+		}
+		rc := C.zmsg_addmem(msg, p, C.size_t(len(d)))
+		if rc == -1 {
+			C.zmsg_destroy(&msg)
+			return nil, fmt.Errorf("%s: can't add memory buffer", method)
+		}
+	}
+	return msg, nil
+}
+
 // convert `zlist_t*` to string slice and DESTROY the zlist
 func zlistTosliceAndDestroy(list *C.zlist_t) []string {
 	if list == nil {
@@ -378,37 +666,99 @@ func zlistTosliceAndDestroy(list *C.zlist_t) []string {
 
 // Peers - Return zlist of current peer ids.
 func (z *Node) Peers() []string {
-	if z.ptr == nil {
-		panic("Node.Peers: z.ptr is null")
-	}
+	z.lock("Node.Peers")
+	defer z.mu.Unlock()
 	cpeers := C.zyre_peers(z.ptr)
 	return zlistTosliceAndDestroy(cpeers)
 }
 
 // PeersByGroup - Return zlist of current peers of this group.
 func (z *Node) PeersByGroup(group string) []string {
-	if z.ptr == nil {
-		panic("Node.PeersByGroup: z.ptr is null")
-	}
-	cpeers := C.zyre_peers_by_group(z.ptr, C.CString(group))
+	z.lock("Node.PeersByGroup")
+	defer z.mu.Unlock()
+	cgroup, free := cString(group)
+	defer free()
+	cpeers := C.zyre_peers_by_group(z.ptr, cgroup)
 	return zlistTosliceAndDestroy(cpeers)
 }
 
 // PeerGroups Return zlist of current peers of this group.
 func (z *Node) PeerGroups() []string {
-	if z.ptr == nil {
-		panic("Node.PeerGroups: z.ptr is null")
-	}
+	z.lock("Node.PeerGroups")
+	defer z.mu.Unlock()
 	cpeers := C.zyre_peer_groups(z.ptr)
 	return zlistTosliceAndDestroy(cpeers)
 }
 
+// OwnGroups - return list of groups the node has joined
+func (z *Node) OwnGroups() []string {
+	z.lock("Node.OwnGroups")
+	defer z.mu.Unlock()
+	cgroups := C.zyre_own_groups(z.ptr)
+	return zlistTosliceAndDestroy(cgroups)
+}
+
+// PeerName - return the name of a connected peer or false if not found
+func (z *Node) PeerName(peer string) (name string, ok bool) {
+	z.lock("Node.PeerName")
+	defer z.mu.Unlock()
+	cpeer, free := cString(peer)
+	defer free()
+	cname := C.zyre_peer_name(z.ptr, cpeer)
+	if cname == nil {
+		ok = false
+		return
+	}
+	defer C.free(unsafe.Pointer(cname))
+	name = C.GoString(cname)
+	ok = true
+	return
+}
+
+// PeerHeaders - return all headers of a connected peer or false if not
+// found. libzyre can return only a value of known header, so names of headers
+// are remembered from Enter events and their values are read from libzyre.
+// Headers are known only for peers whose Enter was received by Recv, ok is
+// false for other peers, both backends behave the same. PeerHeaderValue
+// works for any connected peer.
+func (z *Node) PeerHeaders(peer string) (headers map[string]string, ok bool) {
+	z.trackMu.Lock()
+	names, ok := z.headers[peer]
+	z.trackMu.Unlock()
+	if !ok {
+		return
+	}
+
+	z.lock("Node.PeerHeaders")
+	defer z.mu.Unlock()
+	cpeer, free := cString(peer)
+	defer free()
+	caddress := C.zyre_peer_address(z.ptr, cpeer)
+	if caddress == nil {
+		return nil, false
+	}
+	C.free(unsafe.Pointer(caddress))
+	headers = make(map[string]string, len(names))
+	for _, name := range names {
+		cname, free := cString(name)
+		cvalue := C.zyre_peer_header_value(z.ptr, cpeer, cname)
+		free()
+		if cvalue == nil {
+			continue
+		}
+		headers[name] = C.GoString(cvalue)
+		C.free(unsafe.Pointer(cvalue))
+	}
+	return
+}
+
 // PeerAddress - return the endpoint of a connected peer or false if not found
 func (z *Node) PeerAddress(peer string) (address string, ok bool) {
-	if z.ptr == nil {
-		panic("Node.PeerAddress: z.ptr is null")
-	}
-	caddress := C.zyre_peer_address(z.ptr, C.CString(peer))
+	z.lock("Node.PeerAddress")
+	defer z.mu.Unlock()
+	cpeer, free := cString(peer)
+	defer free()
+	caddress := C.zyre_peer_address(z.ptr, cpeer)
 	if caddress == nil {
 		ok = false
 		return
@@ -422,10 +772,13 @@ func (z *Node) PeerAddress(peer string) (address string, ok bool) {
 // PeerHeaderValue - Return the value of a header of a conected peer.
 // Returns ok false if peer or key doesn't exits.
 func (z *Node) PeerHeaderValue(peer string, key string) (value string, ok bool) {
-	if z.ptr == nil {
-		panic("Node.PeerHeaderValue: z.ptr is null")
-	}
-	cvalue := C.zyre_peer_header_value(z.ptr, C.CString(peer), C.CString(key))
+	z.lock("Node.PeerHeaderValue")
+	defer z.mu.Unlock()
+	cpeer, free := cString(peer)
+	defer free()
+	ckey, free := cString(key)
+	defer free()
+	cvalue := C.zyre_peer_header_value(z.ptr, cpeer, ckey)
 	if cvalue == nil {
 		ok = false
 		return
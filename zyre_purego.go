@@ -0,0 +1,1180 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build purego || !cgo
+// +build purego !cgo
+
+package zyre
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeromq/gozyre/internal/zre"
+)
+
+// Pure Go implementation of Node, selected by purego build tag. It speaks
+// ZRE protocol itself (UDP beacons, ZMTP connections to peers), so it
+// does not need libzmq, czmq nor libzyre and interoperates with C zyre
+// peers. Gossip discovery and leader election are not supported, Start of
+// node set up for gossip and ContestInGroup of the draft API return
+// ErrNotSupported. ELECTION and LEADER messages of C peers are ignored, so C
+// peers contesting in a group which has a pure Go member may not elect a
+// leader.
+//
+// All state is owned by an actor goroutine started by New, the API
+// sends it commands, so Node is safe for concurrent use.
+
+const (
+	defaultPort           = 5670
+	defaultInterval       = 1000 * time.Millisecond
+	defaultEvasiveTimeout = 5000 * time.Millisecond
+	defaultExpiredTimeout = 30000 * time.Millisecond
+	reapInterval          = 1000 * time.Millisecond
+	reconnectInterval     = 100 * time.Millisecond
+	handshakeTimeout      = 5000 * time.Millisecond
+	peerQueueSize         = 10000 // Whisper and Shout wait above it
+	beaconBufferSize      = 255
+)
+
+// Node is Golang implementation of zyre node. It is safe for concurrent use,
+// all calls are executed by the goroutine owning the node state.
+type Node struct {
+	uuid    [16]byte
+	uuidStr string
+	name    string
+	cmds    chan func()
+	done    chan struct{}
+	events  *eventQueue
+	destroy sync.Once
+	inbox   chan inboxMsg
+	beacons chan beaconMsg
+
+	// peers whose Enter was received by Recv, PeerHeaders returns headers
+	// only for them, as the C backend does
+	trackMu sync.Mutex
+	entered map[string]bool
+
+	// state below is owned by actor goroutine
+	headers    map[string]string
+	verbose    bool
+	port       int
+	iface      string
+	interval   time.Duration
+	evasive    time.Duration
+	expired    time.Duration
+	gossip     bool
+	started    bool
+	terminated bool
+	endpoint   string
+	status     uint8
+	ownGroups  []string
+	peers      map[string]*peer
+	peerGroups map[string]map[string]*peer
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	listener   net.Listener
+	inbounds   *connSet
+	beacon     net.PacketConn
+	broadcast  *net.UDPAddr
+	beaconTick *time.Ticker
+}
+
+type inboxMsg struct {
+	identity []byte
+	frames   [][]byte
+}
+
+type beaconMsg struct {
+	addr   *net.UDPAddr
+	beacon zre.Beacon
+}
+
+// New creates a new zyre.Node. Note that until you Start the
+// node it is silent and invisible to other nodes on the network.
+func New(name string, options ...Option) (*Node, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	return newNode(name).apply(options)
+}
+
+// NewUnique creates a new zyre.Node with unique name. Note that until you
+// Start the node it is silent and invisible to other nodes on the network.
+func NewUnique(options ...Option) (*Node, error) {
+	return newNode("").apply(options)
+}
+
+func newNode(name string) *Node {
+	z := &Node{
+		cmds:       make(chan func()),
+		done:       make(chan struct{}),
+		events:     newEventQueue(),
+		entered:    make(map[string]bool),
+		inbox:      make(chan inboxMsg),
+		beacons:    make(chan beaconMsg),
+		headers:    make(map[string]string),
+		port:       defaultPort,
+		interval:   defaultInterval,
+		evasive:    defaultEvasiveTimeout,
+		expired:    defaultExpiredTimeout,
+		peers:      make(map[string]*peer),
+		peerGroups: make(map[string]map[string]*peer),
+	}
+	rand.Read(z.uuid[:])
+	z.uuid[6] = (z.uuid[6] & 0x0F) | 0x40 // version 4
+	z.uuid[8] = (z.uuid[8] & 0x3F) | 0x80 // variant RFC 4122
+	z.uuidStr = uuidString(z.uuid[:])
+	z.name = name
+	if z.name == "" {
+		z.name = z.uuidStr[:6]
+	}
+	go z.run()
+	return z
+}
+
+// Destroy - destroys a Node node. When you destroy a node, any messages it is
+// sending or receiving will be discarded.
+func (z *Node) Destroy() {
+	z.destroy.Do(func() {
+		z.cmds <- func() {
+			if z.started {
+				z.stopNode()
+			}
+			z.terminated = true
+		}
+		<-z.done
+		z.events.close()
+	})
+}
+
+// call runs f in actor goroutine and waits until it finishes
+func (z *Node) call(method string, f func()) {
+	ret := make(chan struct{})
+	select {
+	case z.cmds <- func() { f(); close(ret) }:
+		<-ret
+	case <-z.done:
+		panic(method + ": node is destroyed")
+	}
+}
+
+// UUID - Return our node UUID string, after successful initialization
+func (z *Node) UUID() string {
+	z.call("Node.UUID", func() {})
+	return z.uuidStr
+}
+
+// Name - return our node name, after successful initialization
+func (z *Node) Name() string {
+	z.call("Node.Name", func() {})
+	return z.name
+}
+
+// SetEndpoint - gossip discovery is not supported by pure Go backend, it
+// always returns ErrNotSupported.
+func (z *Node) SetEndpoint(format string, a ...interface{}) error {
+	z.call("Node.SetEndpoint", func() {})
+	return ErrNotSupported
+}
+
+// GossipBind - gossip discovery is not supported by pure Go backend, Start
+// returns ErrNotSupported afterwards.
+func (z *Node) GossipBind(format string, a ...interface{}) {
+	z.call("Node.GossipBind", func() { z.gossip = true })
+}
+
+// GossipConnect - gossip discovery is not supported by pure Go backend, Start
+// returns ErrNotSupported afterwards.
+func (z *Node) GossipConnect(format string, a ...interface{}) {
+	z.call("Node.GossipConnect", func() { z.gossip = true })
+}
+
+// Start - starts a node, after setting header values. When you start a node it
+// begins discovery and connection. Returns error if it wasn't
+// possible to start the node.
+func (z *Node) Start() (err error) {
+	z.call("Node.Start", func() { err = z.startNode() })
+	return
+}
+
+// Stop node; this signals to other peers that this node will go away.
+// This is polite; however you can also just destroy the node without
+// stopping it.
+func (z *Node) Stop() {
+	z.call("Node.Stop", func() {
+		if z.started {
+			z.stopNode()
+		}
+	})
+}
+
+// Join a named group; after joining a group you can send messages to
+// the group and all Node nodes in that group will receive them.
+func (z *Node) Join(room string) error {
+	z.call("Node.Join", func() {
+		for _, g := range z.ownGroups {
+			if g == room {
+				return
+			}
+		}
+		z.ownGroups = append(z.ownGroups, room)
+		z.status++
+		for _, p := range z.peers {
+			p.send(&zre.Msg{ID: zre.Join, Group: room, Status: z.status})
+		}
+		z.logf("I: (%s) JOIN group=%s", z.name, room)
+	})
+	return nil
+}
+
+// Leave a group
+func (z *Node) Leave(room string) error {
+	z.call("Node.Leave", func() {
+		for i, g := range z.ownGroups {
+			if g != room {
+				continue
+			}
+			z.ownGroups = append(z.ownGroups[:i], z.ownGroups[i+1:]...)
+			z.status++
+			for _, p := range z.peers {
+				p.send(&zre.Msg{ID: zre.Leave, Group: room, Status: z.status})
+			}
+			z.logf("I: (%s) LEAVE group=%s", z.name, room)
+			return
+		}
+	})
+	return nil
+}
+
+// Recv - Receive next message from network; the message may be a control
+// message (Enter, Exit, Join, Leave) or data (Whisper, Shout).
+// Caller can use Event methods or type switch and type assertions to get
+// the exact type.
+// Returns ErrRecvNil if node was destroyed.
+func (z *Node) Recv() (m Event, err error) {
+	return z.RecvContext(context.Background())
+}
+
+// RecvContext - Receive next message from network like Recv, but gives up
+// when ctx is cancelled or its deadline expires. Returns ctx.Err() if ctx
+// is done before a message arrives.
+func (z *Node) RecvContext(ctx context.Context) (m Event, err error) {
+	m, err = z.events.pop(ctx)
+	if err == nil {
+		z.track(m)
+	}
+	return
+}
+
+// track updates peers whose Enter was received
+func (z *Node) track(m Event) {
+	z.trackMu.Lock()
+	defer z.trackMu.Unlock()
+	switch m := m.(type) {
+	case Enter:
+		z.entered[m.Peer] = true
+	case Exit:
+		delete(z.entered, m.Peer)
+	case Stop:
+		z.entered = make(map[string]bool)
+	}
+}
+
+// RecvTimeout - Receive next message from network like Recv, but gives up
+// after timeout. Returns context.DeadlineExceeded if no message arrived in time.
+func (z *Node) RecvTimeout(timeout time.Duration) (m Event, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return z.RecvContext(ctx)
+}
+
+// Whisper - sends byte slice to a single peer specified as UUID string
+func (z *Node) Whisper(peer string, data ...[]byte) error {
+	content := copyFrames(data)
+	var room <-chan struct{}
+	z.call("Node.Whisper", func() {
+		if p, ok := z.peers[peer]; ok {
+			room = p.send(&zre.Msg{ID: zre.Whisper, Content: content})
+		}
+	})
+	if room != nil {
+		<-room
+	}
+	return nil
+}
+
+// WhisperString - sends formatted string to a single peer specified as UUID string
+func (z *Node) WhisperString(peer string, format string, a ...interface{}) error {
+	return z.Whisper(peer, []byte(fmt.Sprintf(format, a...)))
+}
+
+// Shout - sends byte slice to a single peer specified as UUID string
+func (z *Node) Shout(group string, data ...[]byte) error {
+	content := copyFrames(data)
+	var rooms []<-chan struct{}
+	z.call("Node.Shout", func() {
+		for _, p := range z.peerGroups[group] {
+			if room := p.send(&zre.Msg{ID: zre.Shout, Group: group, Content: content}); room != nil {
+				rooms = append(rooms, room)
+			}
+		}
+	})
+	for _, room := range rooms {
+		<-room
+	}
+	return nil
+}
+
+// ShoutString - Send formatted string to a named group
+func (z *Node) ShoutString(group string, format string, a ...interface{}) error {
+	return z.Shout(group, []byte(fmt.Sprintf(format, a...)))
+}
+
+// Peers - Return zlist of current peer ids.
+func (z *Node) Peers() (peers []string) {
+	z.call("Node.Peers", func() {
+		peers = make([]string, 0, len(z.peers))
+		for uuid := range z.peers {
+			peers = append(peers, uuid)
+		}
+	})
+	return
+}
+
+// PeersByGroup - Return zlist of current peers of this group.
+func (z *Node) PeersByGroup(group string) (peers []string) {
+	z.call("Node.PeersByGroup", func() {
+		peers = make([]string, 0, len(z.peerGroups[group]))
+		for uuid := range z.peerGroups[group] {
+			peers = append(peers, uuid)
+		}
+	})
+	return
+}
+
+// PeerGroups Return zlist of current peers of this group.
+func (z *Node) PeerGroups() (groups []string) {
+	z.call("Node.PeerGroups", func() {
+		groups = make([]string, 0, len(z.peerGroups))
+		for group := range z.peerGroups {
+			groups = append(groups, group)
+		}
+	})
+	return
+}
+
+// OwnGroups - return list of groups the node has joined
+func (z *Node) OwnGroups() (groups []string) {
+	z.call("Node.OwnGroups", func() {
+		groups = append([]string{}, z.ownGroups...)
+	})
+	return
+}
+
+// PeerName - return the name of a connected peer or false if not found
+func (z *Node) PeerName(peer string) (name string, ok bool) {
+	z.call("Node.PeerName", func() {
+		if p, found := z.peers[peer]; found {
+			name, ok = p.name, true
+		}
+	})
+	return
+}
+
+// PeerHeaders - return all headers of a connected peer or false if not
+// found. Like on the C backend, headers are known only for peers whose Enter
+// was received by Recv, ok is false for other peers. PeerHeaderValue works
+// for any connected peer.
+func (z *Node) PeerHeaders(peer string) (headers map[string]string, ok bool) {
+	z.trackMu.Lock()
+	entered := z.entered[peer]
+	z.trackMu.Unlock()
+	if !entered {
+		return
+	}
+	z.call("Node.PeerHeaders", func() {
+		if p, found := z.peers[peer]; found {
+			headers, ok = copyHeaders(p.headers), true
+		}
+	})
+	return
+}
+
+// PeerAddress - return the endpoint of a connected peer or false if not found
+func (z *Node) PeerAddress(peer string) (address string, ok bool) {
+	z.call("Node.PeerAddress", func() {
+		if p, found := z.peers[peer]; found {
+			address, ok = p.endpoint, true
+		}
+	})
+	return
+}
+
+// PeerHeaderValue - Return the value of a header of a conected peer.
+// Returns ok false if peer or key doesn't exits.
+func (z *Node) PeerHeaderValue(peer string, key string) (value string, ok bool) {
+	z.call("Node.PeerHeaderValue", func() {
+		if p, found := z.peers[peer]; found {
+			value, ok = p.headers[key]
+		}
+	})
+	return
+}
+
+// run is the actor goroutine
+func (z *Node) run() {
+	defer close(z.done)
+	reap := time.NewTicker(reapInterval)
+	defer reap.Stop()
+	for {
+		var beaconC <-chan time.Time
+		if z.beaconTick != nil {
+			beaconC = z.beaconTick.C
+		}
+		select {
+		case f := <-z.cmds:
+			f()
+			if z.terminated {
+				return
+			}
+		case m := <-z.inbox:
+			z.recvPeer(m)
+		case b := <-z.beacons:
+			z.recvBeacon(b)
+		case <-beaconC:
+			z.sendBeacon(uint16(z.listener.Addr().(*net.TCPAddr).Port))
+		case <-reap.C:
+			z.pingPeers()
+		}
+	}
+}
+
+func (z *Node) startNode() error {
+	if z.started {
+		return nil
+	}
+	if z.gossip {
+		return ErrNotSupported
+	}
+	ip, broadcast, err := zre.Interface(z.iface)
+	if err != nil {
+		z.logf("E: (%s) %s", z.name, err)
+		return ErrStart
+	}
+	beacon, err := zre.ListenBeacon(z.port)
+	if err != nil {
+		z.logf("E: (%s) %s", z.name, err)
+		return ErrStart
+	}
+	listener, err := net.Listen("tcp4", ":0")
+	if err != nil {
+		beacon.Close()
+		z.logf("E: (%s) %s", z.name, err)
+		return ErrStart
+	}
+	z.beacon = beacon
+	z.broadcast = &net.UDPAddr{IP: broadcast, Port: z.port}
+	z.listener = listener
+	z.inbounds = newConnSet()
+	z.endpoint = fmt.Sprintf("tcp://%s:%d", ip, listener.Addr().(*net.TCPAddr).Port)
+	z.stop = make(chan struct{})
+	z.started = true
+
+	z.wg.Add(2)
+	go z.acceptLoop(listener, z.inbounds, z.stop)
+	go z.beaconLoop(beacon, z.stop)
+	z.sendBeacon(uint16(listener.Addr().(*net.TCPAddr).Port))
+	z.beaconTick = time.NewTicker(z.interval)
+	z.logf("I: (%s) started, endpoint=%s", z.name, z.endpoint)
+	return nil
+}
+
+func (z *Node) stopNode() {
+	// zero port means we're stopping
+	z.sendBeacon(0)
+	z.beaconTick.Stop()
+	z.beaconTick = nil
+	close(z.stop)
+	z.listener.Close()
+	z.beacon.Close()
+	z.inbounds.closeAll()
+	z.wg.Wait()
+	for _, p := range z.peers {
+		p.disconnect()
+	}
+	z.peers = make(map[string]*peer)
+	z.peerGroups = make(map[string]map[string]*peer)
+	z.started = false
+	z.events.push(Stop{Peer: z.uuidStr, Name: z.name, at: time.Now()})
+	z.logf("I: (%s) stopped", z.name)
+}
+
+func (z *Node) sendBeacon(port uint16) {
+	b := zre.Beacon{UUID: z.uuid, Port: port}
+	_, err := z.beacon.WriteTo(b.Marshal(), z.broadcast)
+	if err != nil {
+		z.logf("W: (%s) can't send beacon: %s", z.name, err)
+	}
+}
+
+// beaconLoop receives beacons and passes them to actor
+func (z *Node) beaconLoop(conn net.PacketConn, stop chan struct{}) {
+	defer z.wg.Done()
+	buf := make([]byte, beaconBufferSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		b, err := zre.UnmarshalBeacon(buf[:n])
+		if err != nil || b.UUID == z.uuid {
+			continue
+		}
+		select {
+		case z.beacons <- beaconMsg{addr: addr.(*net.UDPAddr), beacon: b}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// acceptLoop accepts connections from peers' mailboxes to our inbox
+func (z *Node) acceptLoop(listener net.Listener, inbounds *connSet, stop chan struct{}) {
+	defer z.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if !inbounds.add(conn) {
+			// node is stopping
+			conn.Close()
+			return
+		}
+		z.wg.Add(1)
+		go z.inboxLoop(conn, inbounds, stop)
+	}
+}
+
+// inboxLoop reads messages sent to our inbox by one peer
+func (z *Node) inboxLoop(conn net.Conn, inbounds *connSet, stop chan struct{}) {
+	defer z.wg.Done()
+	defer inbounds.remove(conn)
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	c, err := zre.Handshake(conn, "ROUTER", nil)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	for {
+		frames, err := c.Recv()
+		if err != nil {
+			return
+		}
+		select {
+		case z.inbox <- inboxMsg{identity: c.PeerIdentity, frames: frames}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (z *Node) recvBeacon(m beaconMsg) {
+	if !z.started {
+		return
+	}
+	uuid := uuidString(m.beacon.UUID[:])
+	if m.beacon.Port == 0 {
+		// zero port means peer is going away
+		if p, ok := z.peers[uuid]; ok {
+			z.removePeer(p)
+		}
+		return
+	}
+	endpoint := fmt.Sprintf("tcp://%s:%d", m.addr.IP, m.beacon.Port)
+	p := z.requirePeer(uuid, endpoint)
+	p.refresh(z.evasive, z.expired)
+}
+
+func (z *Node) recvPeer(m inboxMsg) {
+	if !z.started {
+		return
+	}
+	// identity is 1 followed by 16 bytes of UUID
+	if len(m.identity) != 17 || m.identity[0] != 1 {
+		return
+	}
+	uuid := uuidString(m.identity[1:])
+	msg, err := zre.Unmarshal(m.frames)
+	if err != nil {
+		z.logf("W: (%s) invalid message from %s: %s", z.name, uuid, err)
+		return
+	}
+
+	p := z.peers[uuid]
+	if msg.ID == zre.Hello {
+		if p != nil {
+			if p.ready {
+				// peer has restarted
+				z.removePeer(p)
+			} else if p.endpoint == z.endpoint {
+				// ignore HELLO, if peer has same endpoint as current node
+				return
+			}
+		}
+		p = z.requirePeer(uuid, msg.Endpoint)
+		p.ready = true
+	}
+	// ignore command if peer isn't ready
+	if p == nil || !p.ready {
+		return
+	}
+	if p.messagesLost(msg) {
+		z.logf("W: (%s) messages lost from %s", z.name, p.name)
+		z.removePeer(p)
+		return
+	}
+
+	now := time.Now()
+	switch msg.ID {
+	case zre.Hello:
+		p.name = msg.Name
+		p.headers = msg.Headers
+		z.events.push(Enter{
+			Peer:     uuid,
+			Name:     p.name,
+			Headers:  copyHeaders(p.headers),
+			Endpoint: p.endpoint,
+			at:       now,
+		})
+		for _, group := range msg.Groups {
+			z.joinPeerGroup(p, group)
+		}
+		p.status = msg.Status
+	case zre.Whisper:
+		z.events.push(Whisper{
+			Peer:    uuid,
+			Name:    p.name,
+			Message: msg.Content,
+			at:      now,
+		})
+	case zre.Shout:
+		z.events.push(Shout{
+			Peer:    uuid,
+			Name:    p.name,
+			Group:   msg.Group,
+			Message: msg.Content,
+			at:      now,
+		})
+	case zre.Ping:
+		p.send(&zre.Msg{ID: zre.PingOK})
+	case zre.Join:
+		z.joinPeerGroup(p, msg.Group)
+		p.status = msg.Status
+	case zre.Leave:
+		z.leavePeerGroup(p, msg.Group)
+		p.status = msg.Status
+	case zre.Election, zre.Leader:
+		// leader election is not supported, the node does not take part
+		// in elections of C peers and never reports Leader events
+		kind := "ELECTION"
+		if msg.ID == zre.Leader {
+			kind = "LEADER"
+		}
+		z.logf("W: (%s) %s from %s in group %s ignored, leader election is not supported",
+			z.name, kind, p.name, msg.Group)
+	}
+	p.refresh(z.evasive, z.expired)
+}
+
+// requirePeer returns peer with uuid, connecting to it if it is not known yet
+func (z *Node) requirePeer(uuid string, endpoint string) *peer {
+	if p, ok := z.peers[uuid]; ok {
+		return p
+	}
+	// purge any previous peer on same endpoint
+	for _, p := range z.peers {
+		if p.endpoint == endpoint {
+			z.removePeer(p)
+		}
+	}
+	p := newPeer(uuid, endpoint)
+	p.refresh(z.evasive, z.expired)
+	z.peers[uuid] = p
+	p.connect(append([]byte{1}, z.uuid[:]...), logger(z.verbose))
+
+	// handshake discovery by sending HELLO as first message
+	p.send(&zre.Msg{
+		ID:       zre.Hello,
+		Endpoint: z.endpoint,
+		Groups:   append([]string(nil), z.ownGroups...),
+		Status:   z.status,
+		Name:     z.name,
+		Headers:  copyHeaders(z.headers),
+	})
+	z.logf("I: (%s) connect to peer %s at %s", z.name, uuid, endpoint)
+	return p
+}
+
+func (z *Node) removePeer(p *peer) {
+	if p.ready {
+		z.events.push(Exit{Peer: p.uuid, Name: p.name, at: time.Now()})
+	}
+	for group, peers := range z.peerGroups {
+		delete(peers, p.uuid)
+		if len(peers) == 0 {
+			delete(z.peerGroups, group)
+		}
+	}
+	p.disconnect()
+	delete(z.peers, p.uuid)
+}
+
+func (z *Node) joinPeerGroup(p *peer, group string) {
+	peers, ok := z.peerGroups[group]
+	if !ok {
+		peers = make(map[string]*peer)
+		z.peerGroups[group] = peers
+	}
+	peers[p.uuid] = p
+	z.events.push(Join{Peer: p.uuid, Name: p.name, Group: group, at: time.Now()})
+}
+
+func (z *Node) leavePeerGroup(p *peer, group string) {
+	if peers, ok := z.peerGroups[group]; ok {
+		delete(peers, p.uuid)
+		if len(peers) == 0 {
+			delete(z.peerGroups, group)
+		}
+	}
+	z.events.push(Leave{Peer: p.uuid, Name: p.name, Group: group, at: time.Now()})
+}
+
+// pingPeers removes expired peers and pings evasive ones
+func (z *Node) pingPeers() {
+	now := time.Now()
+	for _, p := range z.peers {
+		if now.After(p.expiredAt) {
+			z.logf("I: (%s) peer %s expired", z.name, p.uuid)
+			z.removePeer(p)
+		} else if now.After(p.evasiveAt) {
+			// if peer is being evasive, force a TCP ping
+			p.send(&zre.Msg{ID: zre.Ping})
+			if p.ready {
+				z.events.push(Evasive{Peer: p.uuid, Name: p.name, at: now})
+			}
+		}
+	}
+}
+
+func (z *Node) logf(format string, a ...interface{}) {
+	if z.verbose {
+		log.Printf(format, a...)
+	}
+}
+
+// logger returns logging function for goroutines other than actor
+func logger(verbose bool) func(string, ...interface{}) {
+	return func(format string, a ...interface{}) {
+		if verbose {
+			log.Printf(format, a...)
+		}
+	}
+}
+
+// peer is a remote node, messages are sent to its inbox from a mailbox
+// goroutine, so the actor never blocks on the network
+type peer struct {
+	uuid         string
+	name         string
+	endpoint     string
+	headers      map[string]string
+	ready        bool
+	connected    bool
+	status       uint8
+	sentSequence uint16
+	wantSequence uint16
+	evasiveAt    time.Time
+	expiredAt    time.Time
+	out          *outQueue
+	quit         chan struct{}
+}
+
+func newPeer(uuid string, endpoint string) *peer {
+	return &peer{
+		uuid:     uuid,
+		endpoint: endpoint,
+		headers:  make(map[string]string),
+	}
+}
+
+func (p *peer) connect(identity []byte, logf func(string, ...interface{})) {
+	p.out = newOutQueue()
+	p.quit = make(chan struct{})
+	p.connected = true
+	go p.mailbox(identity, logf)
+}
+
+func (p *peer) disconnect() {
+	if !p.connected {
+		return
+	}
+	p.connected = false
+	close(p.quit)
+	p.out.close()
+}
+
+// send queues message for peer. Returns channel closed when the queue has
+// room again, nil if it has room, callers of Whisper and Shout wait for it.
+func (p *peer) send(msg *zre.Msg) <-chan struct{} {
+	if !p.connected {
+		return nil
+	}
+	p.sentSequence++
+	msg.Sequence = p.sentSequence
+	return p.out.push(msg.Marshal())
+}
+
+func (p *peer) refresh(evasive, expired time.Duration) {
+	now := time.Now()
+	p.evasiveAt = now.Add(evasive)
+	p.expiredAt = now.Add(expired)
+}
+
+// messagesLost checks sequence of received message
+func (p *peer) messagesLost(msg *zre.Msg) bool {
+	if msg.ID == zre.Hello {
+		p.wantSequence = 1
+	} else {
+		p.wantSequence++
+	}
+	return p.wantSequence != msg.Sequence
+}
+
+// mailbox connects to the peer, reconnecting when needed, and writes queued
+// messages until the peer is disconnected
+func (p *peer) mailbox(identity []byte, logf func(string, ...interface{})) {
+	address := strings.TrimPrefix(p.endpoint, "tcp://")
+	for {
+		conn, err := net.DialTimeout("tcp", address, handshakeTimeout)
+		var c *zre.Conn
+		if err == nil {
+			conn.SetDeadline(time.Now().Add(handshakeTimeout))
+			c, err = zre.Handshake(conn, "DEALER", identity)
+			if err != nil {
+				conn.Close()
+			} else {
+				conn.SetDeadline(time.Time{})
+			}
+		}
+		if err != nil {
+			logf("W: can't connect to %s: %s", p.endpoint, err)
+			select {
+			case <-p.quit:
+				return
+			case <-time.After(reconnectInterval):
+				continue
+			}
+		}
+
+		// nothing is expected from peer, but commands must be handled
+		go func() {
+			for {
+				if _, err := c.Recv(); err != nil {
+					return
+				}
+			}
+		}()
+
+	send:
+		for {
+			frames, ok := p.out.pop()
+			if !ok {
+				select {
+				case <-p.quit:
+					c.Close()
+					return
+				case <-p.out.signal:
+				}
+				continue
+			}
+			if err := c.Send(frames); err != nil {
+				c.Close()
+				break send
+			}
+		}
+	}
+}
+
+// outQueue holds messages for a peer, actor pushes them and mailbox
+// goroutine pops them. Push never blocks the actor, so the queue is not
+// bounded, but callers of Whisper and Shout wait while it holds more than
+// peerQueueSize messages. Slow peer slows down senders instead of being
+// disconnected.
+type outQueue struct {
+	signal chan struct{}
+
+	mu     sync.Mutex
+	msgs   [][][]byte
+	room   chan struct{}
+	closed bool
+}
+
+func newOutQueue() *outQueue {
+	return &outQueue{
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// push queues message, returns channel closed when the queue has room
+// again or nil if it has room
+func (q *outQueue) push(frames [][]byte) <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.msgs = append(q.msgs, frames)
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	if len(q.msgs) <= peerQueueSize {
+		return nil
+	}
+	if q.room == nil {
+		q.room = make(chan struct{})
+	}
+	return q.room
+}
+
+// pop returns the oldest message, ok is false when the queue is empty
+func (q *outQueue) pop() (frames [][]byte, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.msgs) == 0 {
+		return nil, false
+	}
+	frames = q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+	if len(q.msgs) <= peerQueueSize && q.room != nil {
+		close(q.room)
+		q.room = nil
+	}
+	return frames, true
+}
+
+// close drops queued messages and releases waiting senders
+func (q *outQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.msgs = nil
+	if q.room != nil {
+		close(q.room)
+		q.room = nil
+	}
+}
+
+// connSet tracks inbound connections, so they can be closed on Stop
+type connSet struct {
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]bool
+}
+
+func newConnSet() *connSet {
+	return &connSet{
+		conns: make(map[net.Conn]bool),
+	}
+}
+
+func (s *connSet) add(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = true
+	return true
+}
+
+func (s *connSet) remove(c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+	c.Close()
+}
+
+func (s *connSet) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// eventQueue is unbounded queue of events for Recv, so the actor never
+// blocks on slow reader
+type eventQueue struct {
+	mu     sync.Mutex
+	items  []Event
+	ready  chan struct{}
+	closed bool
+
+	// channels of pollers waiting for the queue
+	watchers map[chan struct{}]struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+func (q *eventQueue) push(e Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, e)
+	q.signal()
+}
+
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+// signal wakes up one waiting pop and all pollers, caller must hold the lock
+func (q *eventQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	for w := range q.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch registers channel signalled when queue becomes readable
+func (q *eventQueue) watch(w chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.watchers == nil {
+		q.watchers = make(map[chan struct{}]struct{})
+	}
+	q.watchers[w] = struct{}{}
+}
+
+func (q *eventQueue) unwatch(w chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.watchers, w)
+}
+
+// readable returns true if pop would not block
+func (q *eventQueue) readable() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items) > 0 || q.closed
+}
+
+func (q *eventQueue) pop(ctx context.Context) (Event, error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			e := q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+			if len(q.items) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return e, nil
+		}
+		if q.closed {
+			q.signal()
+			q.mu.Unlock()
+			return nil, ErrRecvNil
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pollNodes waits until events of some nodes are readable, file
+// descriptors are not supported
+func pollNodes(nodes []*Node, fds []int, timeout time.Duration) ([]*Node, []int, error) {
+	if len(fds) > 0 {
+		return nil, nil, ErrNotSupported
+	}
+	notify := make(chan struct{}, 1)
+	for _, z := range nodes {
+		z.events.watch(notify)
+		defer z.events.unwatch(notify)
+	}
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		var ready []*Node
+		for _, z := range nodes {
+			if z.events.readable() {
+				ready = append(ready, z)
+			}
+		}
+		if len(ready) > 0 {
+			return ready, nil, nil
+		}
+		select {
+		case <-notify:
+		case <-expired:
+			return nil, nil, nil
+		}
+	}
+}
+
+func uuidString(b []byte) string {
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func copyFrames(data [][]byte) [][]byte {
+	frames := make([][]byte, len(data))
+	for i, d := range data {
+		frames[i] = append([]byte{}, d...)
+	}
+	return frames
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	c := make(map[string]string, len(headers))
+	for k, v := range headers {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The GoZyre Authors. All rights reserved.
+// Use of this source code is governed by a MPL-2.0
+// license that can be found in the LICENSE file.
+
+//go:build purego || !cgo
+// +build purego !cgo
+
+package zyre
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromq/gozyre/internal/zre"
+)
+
+func TestPureGoExit(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5690))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5690))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+
+	enter := false
+	for !enter {
+		m, err := node.RecvTimeout(5 * time.Second)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+		_, enter = m.(Enter)
+	}
+
+	// stopped node announces itself by zero port beacon
+	node2.Stop()
+	for {
+		m, err := node.RecvTimeout(5 * time.Second)
+		assert.NoError(err)
+		if err != nil {
+			return
+		}
+		if exit, ok := m.(Exit); ok {
+			assert.Equal(node2.UUID(), exit.Peer)
+			assert.Equal("node2", exit.Name)
+			break
+		}
+	}
+	assert.Empty(node.Peers())
+}
+
+func TestPureGoExpired(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node",
+		SetPort(5691),
+		SetEvasiveTimeout(100*time.Millisecond),
+		SetExpiredTimeout(500*time.Millisecond),
+	)
+	defer node.Destroy()
+	assert.NoError(node.Start())
+
+	// fake peer, which accepts connection but never says HELLO
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go zre.Handshake(conn, "ROUTER", nil)
+		}
+	}()
+
+	b := zre.Beacon{Port: uint16(l.Addr().(*net.TCPAddr).Port)}
+	copy(b.UUID[:], "0123456789abcdef")
+	conn, err := net.Dial("udp4", "127.0.0.1:5691")
+	assert.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write(b.Marshal())
+	assert.NoError(err)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(node.Peers()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal([]string{uuidString(b.UUID[:])}, node.Peers())
+
+	deadline = time.Now().Add(5 * time.Second)
+	for len(node.Peers()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Empty(node.Peers())
+}
+
+func TestPureGoOutQueue(t *testing.T) {
+
+	assert := assert.New(t)
+
+	q := newOutQueue()
+	for i := 0; i != peerQueueSize; i++ {
+		assert.Nil(q.push([][]byte{{byte(i)}}))
+	}
+	// full queue makes sender wait until a message is popped
+	room := q.push([][]byte{{1}})
+	assert.NotNil(room)
+	assert.Equal(room, q.push([][]byte{{2}}))
+	_, ok := q.pop()
+	assert.True(ok)
+	select {
+	case <-room:
+		t.Fatal("room before queue is below limit")
+	default:
+	}
+	frames, ok := q.pop()
+	assert.True(ok)
+	assert.Equal([][]byte{{1}}, frames, "second queued message")
+	<-room
+
+	// closed queue releases waiting senders and drops messages
+	room = q.push([][]byte{{3}})
+	assert.NotNil(room)
+	q.close()
+	<-room
+	_, ok = q.pop()
+	assert.False(ok)
+	assert.Nil(q.push([][]byte{{4}}))
+}
+
+func TestPureGoPeerHeadersAfterEnter(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5692))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5692),
+		SetHeader("X-SERVICE", "%s", "printer"))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+
+	// connected peer has headers only after its Enter is received
+	for i := 0; len(node.Peers()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("peer not connected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	value, ok := node.PeerHeaderValue(node2.UUID(), "X-SERVICE")
+	assert.True(ok)
+	assert.Equal("printer", value)
+	_, ok = node.PeerHeaders(node2.UUID())
+	assert.False(ok)
+
+	for {
+		m, err := node.RecvTimeout(5 * time.Second)
+		if !assert.NoError(err) {
+			return
+		}
+		if m.Type() == EventEnter {
+			break
+		}
+	}
+	headers, ok := node.PeerHeaders(node2.UUID())
+	assert.True(ok)
+	assert.Equal("printer", headers["X-SERVICE"])
+}
@@ -5,7 +5,10 @@
 package zyre
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -16,14 +19,17 @@ func TestZyre(t *testing.T) {
 
 	assert := assert.New(t)
 
-	node := New(
+	node := newTestNode(t,
 		"node",
 		SetHeader("Service", "name"),
 	)
 	defer node.Destroy()
-	node2 := NewUnique(
+	node2, err := NewUnique(
 		SetPort(5670),
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer node2.Destroy()
 	if testing.Verbose() {
 		node.SetVerbose()
@@ -32,7 +38,7 @@ func TestZyre(t *testing.T) {
 
 	node.SetEvasiveTimeout(5000 * time.Millisecond)
 	node.SetExpiredTimeout(30000 * time.Millisecond)
-	err := node.Start()
+	err = node.Start()
 	assert.NoError(err)
 	err = node2.Start()
 	assert.NoError(err)
@@ -74,3 +80,242 @@ func TestZyre(t *testing.T) {
 		}
 	}
 }
+
+// newTestNode creates a node or fails the test
+func newTestNode(t *testing.T, name string, options ...Option) *Node {
+	t.Helper()
+	node, err := New(name, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestRecvContext(t *testing.T) {
+
+	assert := assert.New(t)
+
+	// node which is not started is silent, so nothing can be received
+	node := newTestNode(t, "node")
+	defer node.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m, err := node.RecvContext(ctx)
+	assert.Nil(m)
+	assert.Equal(context.Canceled, err)
+
+	start := time.Now()
+	m, err = node.RecvTimeout(50 * time.Millisecond)
+	assert.Nil(m)
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestDestroyRecv(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node")
+	node2 := newTestNode(t, "node2")
+
+	// Destroy interrupts blocking Recv and Poller.Wait
+	errs := make(chan error, 2)
+	go func() {
+		_, err := node.Recv()
+		errs <- err
+	}()
+	go func() {
+		nodes, _, err := NewPoller(node2).Wait(-1)
+		if err == nil {
+			_, err = nodes[0].Recv()
+		}
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	destroyed := make(chan struct{})
+	go func() {
+		node.Destroy()
+		node2.Destroy()
+		close(destroyed)
+	}()
+	select {
+	case <-destroyed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Destroy blocked by pending Recv")
+	}
+	for i := 0; i != 2; i++ {
+		select {
+		case err := <-errs:
+			assert.Equal(ErrRecvNil, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Recv not interrupted by Destroy")
+		}
+	}
+
+	_, err := node.Recv()
+	assert.Equal(ErrRecvNil, err)
+	node.Destroy()
+
+	// Destroy ends Events
+	node3 := newTestNode(t, "node3")
+	events, evErrs := node3.Events(context.Background())
+	node3.Destroy()
+	select {
+	case err := <-evErrs:
+		assert.Equal(ErrRecvNil, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events not ended by Destroy")
+	}
+	for range events {
+	}
+}
+
+func TestEvents(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node")
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2")
+	defer node2.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := node.Events(ctx, EventsBuffer(1))
+
+	err := node.Start()
+	assert.NoError(err)
+	err = node2.Start()
+	assert.NoError(err)
+
+	timeout := time.After(5 * time.Second)
+wait:
+	for {
+		select {
+		case e := <-events:
+			if m, ok := e.(Enter); ok && m.Peer == node2.UUID() {
+				break wait
+			}
+		case err := <-errs:
+			assert.NoError(err)
+		case <-timeout:
+			t.Fatal("node2 ENTER not received")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+	_, ok := <-errs
+	assert.False(ok)
+	node2.Stop()
+	node.Stop()
+}
+
+func TestMultiFrame(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5672))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5672))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+	assert.NoError(node.Join("MULTI"))
+	assert.NoError(node2.Join("MULTI"))
+
+	// wait until both nodes know the other one is in the group
+	waitJoin := func(n *Node, peer string) bool {
+		for {
+			m, err := n.RecvTimeout(5 * time.Second)
+			if !assert.NoError(err) {
+				return false
+			}
+			if j, ok := m.(Join); ok && j.Peer == peer && j.Group == "MULTI" {
+				return true
+			}
+		}
+	}
+	if !waitJoin(node, node2.UUID()) || !waitJoin(node2, node.UUID()) {
+		return
+	}
+
+	recv := func() Event {
+		for {
+			m, err := node2.RecvTimeout(5 * time.Second)
+			if err != nil {
+				return nil
+			}
+			switch m.(type) {
+			case Whisper, Shout:
+				return m
+			}
+		}
+	}
+
+	for _, count := range []int{1, 2, 5, 16} {
+		for _, size := range []int{0, 1, 255, 256, 65536, 4 << 20} {
+			data := make([][]byte, count)
+			for i := range data {
+				data[i] = bytes.Repeat([]byte{byte('a' + i)}, size)
+			}
+
+			assert.NoError(node.Whisper(node2.UUID(), data...))
+			m, ok := recv().(Whisper)
+			if assert.True(ok, "whisper %d x %d", count, size) {
+				assert.Equal(node.UUID(), m.Peer)
+				assert.Equal(data, m.Message, "whisper %d x %d", count, size)
+			}
+
+			assert.NoError(node.Shout("MULTI", data...))
+			s, ok := recv().(Shout)
+			if assert.True(ok, "shout %d x %d", count, size) {
+				assert.Equal("MULTI", s.Group)
+				assert.Equal(data, s.Message, "shout %d x %d", count, size)
+			}
+		}
+	}
+}
+
+func TestPeerQueries(t *testing.T) {
+
+	assert := assert.New(t)
+
+	node := newTestNode(t, "node", SetPort(5676))
+	defer node.Destroy()
+	node2 := newTestNode(t, "node2", SetPort(5676), SetHeader("X-SERVICE", "printer"))
+	defer node2.Destroy()
+
+	assert.NoError(node.Start())
+	assert.NoError(node2.Start())
+	assert.NoError(node.Join("B"))
+	assert.NoError(node.Join("A"))
+
+	for entered := false; !entered; {
+		m, err := node.RecvTimeout(5 * time.Second)
+		if !assert.NoError(err) {
+			return
+		}
+		entered = m.Type() == EventEnter && m.PeerID() == node2.UUID()
+	}
+
+	groups := node.OwnGroups()
+	sort.Strings(groups)
+	assert.Equal([]string{"A", "B"}, groups)
+	assert.Empty(node2.OwnGroups())
+
+	name, ok := node.PeerName(node2.UUID())
+	assert.True(ok)
+	assert.Equal("node2", name)
+	headers, ok := node.PeerHeaders(node2.UUID())
+	assert.True(ok)
+	assert.Equal("printer", headers["X-SERVICE"])
+
+	_, ok = node.PeerName("NO-SUCH-PEER")
+	assert.False(ok)
+	_, ok = node.PeerHeaders("NO-SUCH-PEER")
+	assert.False(ok)
+}